@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/peeley/carpal/internal/config"
 	"github.com/peeley/carpal/internal/driver"
@@ -12,6 +19,10 @@ import (
 	"github.com/peeley/carpal/internal/driver/ldap"
 	"github.com/peeley/carpal/internal/driver/sql"
 	"github.com/peeley/carpal/internal/handler"
+	"github.com/peeley/carpal/internal/metrics"
+	"github.com/peeley/carpal/internal/middleware"
+	"github.com/peeley/carpal/internal/server"
+	"github.com/peeley/carpal/internal/tracing"
 )
 
 const (
@@ -42,15 +53,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	var driver driver.Driver
+	var resourceDriver driver.Driver
 	switch config.Driver {
 	case "file":
-		driver = file.NewFileDriver(*config)
+		resourceDriver = file.NewFileDriver(*config)
 	case "ldap":
-		driver = ldap.NewLDAPDriver(*config)
+		resourceDriver = ldap.NewLDAPDriver(*config)
 	case "sql":
 		var err error
-		driver, err = sql.NewSQLDriver(*config)
+		resourceDriver, err = sql.NewSQLDriver(*config)
 		if err != nil {
 			slog.Error("failed to initialize SQL driver", "err", err)
 			os.Exit(1)
@@ -60,8 +71,90 @@ func main() {
 		os.Exit(1)
 	}
 
-	handler := handler.NewResourceHandler(driver)
-	http.HandleFunc("/", handler.Handle)
+	resourceHandler, err := handler.NewResourceHandler(resourceDriver, *config)
+	if err != nil {
+		slog.Error("failed to initialize resource handler", "err", err)
+		os.Exit(1)
+	}
+	http.HandleFunc("/", resourceHandler.Handle)
+
+	if config.AvatarConfiguration != nil {
+		avatarDriver, ok := resourceDriver.(driver.AvatarDriver)
+		if !ok {
+			slog.Error(fmt.Sprintf("driver `%s` does not support avatars", config.Driver))
+			os.Exit(1)
+		}
+
+		avatarHandler := handler.NewAvatarHandler(avatarDriver, config.AvatarConfiguration.MaxAge)
+		http.HandleFunc("/avatar/{user}", avatarHandler.Handle)
+	}
+
+	if config.NodeInfoConfiguration != nil {
+		var counter driver.UserCounter
+		if config.NodeInfoConfiguration.CountUsers {
+			var ok bool
+			counter, ok = resourceDriver.(driver.UserCounter)
+			if !ok {
+				slog.Error(fmt.Sprintf("driver `%s` does not support counting users", config.Driver))
+				os.Exit(1)
+			}
+		}
+
+		discoveryHandler := handler.NewNodeInfoDiscoveryHandler(*config.NodeInfoConfiguration)
+		http.HandleFunc("/.well-known/nodeinfo", discoveryHandler.Handle)
+
+		nodeInfoHandler := handler.NewNodeInfoHandler(*config.NodeInfoConfiguration, counter)
+		http.HandleFunc(handler.NODEINFO_PATH, nodeInfoHandler.Handle)
+	}
+
+	if config.NostrConfiguration != nil {
+		nostrHandler := handler.NewNostrHandler(resourceDriver, *config.NostrConfiguration)
+		http.HandleFunc("/.well-known/nostr.json", nostrHandler.Handle)
+	}
+
+	if config.WKDConfiguration != nil {
+		keyDriver, ok := resourceDriver.(driver.OpenPGPKeyDriver)
+		if !ok {
+			slog.Error(fmt.Sprintf("driver `%s` does not support OpenPGP keys", config.Driver))
+			os.Exit(1)
+		}
+
+		wkdHandler := handler.NewWKDHandler(keyDriver, *config.WKDConfiguration)
+		http.HandleFunc(handler.WKD_PATH, wkdHandler.Handle)
+	}
+
+	if config.MatrixConfiguration != nil {
+		matrixHandler := handler.NewMatrixHandler(*config.MatrixConfiguration)
+		http.HandleFunc("/.well-known/matrix/server", matrixHandler.Handle)
+		http.HandleFunc("/.well-known/matrix/client", matrixHandler.Handle)
+	}
+
+	if config.AtprotoConfiguration != nil {
+		atprotoHandler := handler.NewAtprotoHandler(resourceDriver, *config.AtprotoConfiguration)
+		http.HandleFunc("/.well-known/atproto-did", atprotoHandler.Handle)
+	}
+
+	if config.LightningConfiguration != nil {
+		lightningHandler, err := handler.NewLightningHandler(resourceDriver, *config.LightningConfiguration)
+		if err != nil {
+			slog.Error("failed to initialize lightning handler", "err", err)
+			os.Exit(1)
+		}
+		http.HandleFunc("/.well-known/lnurlp/{user}", lightningHandler.Handle)
+	}
+
+	if config.HealthConfiguration != nil {
+		checks := map[string]driver.HealthChecker{}
+		if checker, ok := resourceDriver.(driver.HealthChecker); ok {
+			checks[config.Driver] = checker
+		}
+
+		livenessHandler := handler.NewLivenessHandler()
+		http.HandleFunc("/healthz", livenessHandler.Handle)
+
+		readinessHandler := handler.NewReadinessHandler(checks, *config.HealthConfiguration)
+		http.HandleFunc("/readyz", readinessHandler.Handle)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -74,8 +167,151 @@ func main() {
 		port = DEFAULT_HTTP_PORT
 	}
 
-	slog.Info(fmt.Sprintf("launching carpal server on port %v...", port))
-	slog.Error(fmt.Sprintf("%v", http.ListenAndServe(":"+port, nil)))
+	serverConf := config.ServerConfiguration
+	servers := []server.Server{}
+
+	clientIPResolver := middleware.NewClientIPResolver(config.TrustedProxies)
+
+	var rootHandler http.Handler = http.DefaultServeMux
+	if config.CompressionConfiguration != nil {
+		rootHandler = middleware.Compress(*config.CompressionConfiguration, rootHandler)
+	}
+
+	if config.RateLimitConfiguration != nil {
+		rootHandler = middleware.RateLimit(*config.RateLimitConfiguration, clientIPResolver, rootHandler)
+	}
+
+	if config.MetricsConfiguration != nil {
+		metricsPath := config.MetricsConfiguration.Path
+		if metricsPath == "" {
+			metricsPath = metrics.DEFAULT_METRICS_PATH
+		}
+
+		rootHandler = metrics.Middleware(rootHandler)
+
+		if metricsPort := config.MetricsConfiguration.Port; metricsPort != "" {
+			slog.Info(fmt.Sprintf("serving metrics on port %v...", metricsPort))
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle(metricsPath, metrics.Handler())
+			servers = append(servers, server.Server{HTTP: server.NewHTTPServer(serverConf, ":"+metricsPort, metricsMux)})
+		} else {
+			http.Handle(metricsPath, metrics.Handler())
+		}
+	}
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if config.TracingConfiguration != nil {
+		shutdownTracing, err = tracing.Setup(context.Background(), *config.TracingConfiguration)
+		if err != nil {
+			slog.Error("failed to initialize tracing", "err", err)
+			os.Exit(1)
+		}
+
+		rootHandler = tracing.Middleware(rootHandler)
+	}
+
+	if config.AccessLogConfiguration != nil {
+		rootHandler = middleware.AccessLog(*config.AccessLogConfiguration, clientIPResolver, os.Stdout, rootHandler)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLSConfiguration != nil {
+		tlsConfig, err = server.NewTLSConfig(*config.TLSConfiguration)
+		if err != nil {
+			slog.Error("could not load TLS certificates", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	listeners, err := listen(serverConf, port)
+	if err != nil {
+		slog.Error("could not listen", "err", err)
+		os.Exit(1)
+	}
+
+	if config.TLSConfiguration != nil && config.TLSConfiguration.RedirectPort != "" {
+		redirectPort := config.TLSConfiguration.RedirectPort
+
+		// redirect to the port HTTPS is actually served on, which only matches
+		// `PORT` if no other listen address was given
+		httpsPort := config.TLSConfiguration.HTTPSPort
+		if httpsPort == "" {
+			listenerPort, ok := server.ListenerPort(listeners)
+			if !ok {
+				listenerPort = "443"
+			}
+			httpsPort = listenerPort
+		}
+
+		slog.Info(fmt.Sprintf("redirecting HTTP requests on port %v to HTTPS on port %v...", redirectPort, httpsPort))
+		redirectServer := server.NewHTTPServer(serverConf, ":"+redirectPort, server.NewRedirectHandler(httpsPort))
+		servers = append(servers, server.Server{HTTP: redirectServer})
+	}
+
+	for _, listener := range listeners {
+		mainServer := server.Server{
+			HTTP:     server.NewHTTPServer(serverConf, "", rootHandler),
+			Listener: listener,
+			TLS:      tlsConfig != nil,
+		}
+		mainServer.HTTP.TLSConfig = tlsConfig
+
+		slog.Info(fmt.Sprintf("launching carpal server on %v...", listener.Addr()))
+		servers = append(servers, mainServer)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runErr := server.Run(ctx, serverConf.ShutdownTimeout, servers...)
+	if runErr != nil {
+		slog.Error(fmt.Sprintf("%v", runErr))
+	}
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("failed to flush traces", "err", err)
+	}
+
+	if closer, ok := resourceDriver.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Error("failed to close driver", "err", err)
+		}
+	}
+
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
+
+// listen returns the listeners passed by systemd socket activation, or else
+// listens on the configured addresses, falling back to the port.
+func listen(conf config.ServerConfiguration, port string) ([]net.Listener, error) {
+	listeners, err := server.SystemdListeners()
+	if err != nil || len(listeners) != 0 {
+		return listeners, err
+	}
+
+	addresses := conf.Listen
+	if envAddresses := os.Getenv("LISTEN_ADDRESS"); envAddresses != "" {
+		addresses = strings.Split(envAddresses, ",")
+	}
+	if len(addresses) == 0 {
+		addresses = []string{":" + port}
+	}
+
+	for _, address := range addresses {
+		listener, err := server.Listen(conf, strings.TrimSpace(address))
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("unable to listen on %s: %w", address, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
 }
 
 func configureLogging() {
@@ -92,5 +328,10 @@ func configureLogging() {
 		logLevel = slog.LevelInfo
 	}
 
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+		return
+	}
+
 	slog.SetLogLoggerLevel(logLevel)
 }
@@ -4,7 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"net/netip"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,48 +25,318 @@ type ConfigWizard interface {
 	GetConfiguration() (*Configuration, error)
 	processLDAPBindPassword(config *Configuration) error
 	processDatabaseURL(config *Configuration) error
+	processLDAPFailover(config *Configuration) error
+	processResourcePatterns(config *Configuration) error
+	processDomainAliases(config *Configuration) error
+	processFediverse(config *Configuration) error
+	processNostr(config *Configuration) error
+	processAtproto(config *Configuration) error
+	processLightning(config *Configuration) error
+	processTLS(config *Configuration) error
+	processAccessLog(config *Configuration) error
+	processTrustedProxies(config *Configuration) error
+	processRateLimit(config *Configuration) error
+	processTracing(config *Configuration) error
+	processCache(config *Configuration) error
+	processCompression(config *Configuration) error
+	processListen(config *Configuration) error
 }
 
 type configWizard struct {
 	ConfigFileLocation string
-	ExpandEnvs bool
+	ExpandEnvs         bool
 }
 
 func NewConfigWizard(configFileLocation string, expandEnvs bool) ConfigWizard {
 	return configWizard{configFileLocation, expandEnvs}
 }
 
+type ResourcePattern struct {
+	Match    string `yaml:"match"`    // Regular expression matched against requested resources
+	Resource string `yaml:"resource"` // Resource to look up instead, e.g. `acct:${user}@foobar.com`
+}
+
 type FileConfiguration struct {
-	Directory string `yaml:"directory"`
+	Directory           string            `yaml:"directory"`
+	IndexAliases        bool              `yaml:"index_aliases"` // Resolve resources by the aliases listed in each file
+	ResourcePatterns    []ResourcePattern `yaml:"resource_patterns"`
+	OpenPGPKeyDirectory string            `yaml:"openpgp_key_directory"` // Directory of binary keys named after their address
 }
 
 type LDAPConfiguration struct {
-	URL          string   `yaml:"url"`
-	BindUser     string   `yaml:"bind_user"`
-	BindPass     string   `yaml:"bind_pass"`
-	BindPassFile string   `yaml:"bind_pass_file"`
-	BaseDN       string   `yaml:"basedn"`
-	Filter       string   `yaml:"filter"`
-	UserAttr     string   `yaml:"user_attr"`
-	Attributes   []string `yaml:"attributes"`
-	Template     string   `yaml:"template"`
+	URL              string            `yaml:"url"`
+	URLs             []string          `yaml:"urls"`             // Additional servers, tried after `url`
+	Failover         string            `yaml:"failover"`         // "ordered" (default) or "round_robin"
+	ServerCooldown   time.Duration     `yaml:"server_cooldown"`  // How long a failed server is skipped
+	FollowReferrals  bool              `yaml:"follow_referrals"` // Chase search result references
+	MaxReferralHops  int               `yaml:"max_referral_hops"`
+	BindUser         string            `yaml:"bind_user"`
+	BindPass         string            `yaml:"bind_pass"`
+	BindPassFile     string            `yaml:"bind_pass_file"`
+	BaseDN           string            `yaml:"basedn"`
+	Filter           string            `yaml:"filter"`
+	UserAttr         string            `yaml:"user_attr"`
+	Attributes       []string          `yaml:"attributes"`
+	Template         string            `yaml:"template"`
+	AvatarAttrs      []string          `yaml:"avatar_attributes"` // Binary attributes holding avatar images, e.g. jpegPhoto
+	AliasAttr        string            `yaml:"alias_attr"`        // Attribute searched when resolving aliases
+	Domain           string            `yaml:"domain"`            // Domain of the canonical `acct:` subject for aliases
+	ResourcePatterns []ResourcePattern `yaml:"resource_patterns"`
+	OpenPGPKeyAttr   string            `yaml:"openpgp_key_attr"` // Binary attribute holding the user's OpenPGP key
+	PageSize         uint32            `yaml:"page_size"`        // Page size of searches returning many entries, e.g. counting users
 }
 
+const (
+	LDAPFailoverOrdered    = "ordered"
+	LDAPFailoverRoundRobin = "round_robin"
+)
+
 type DatabaseConfiguration struct {
-	Driver      string   `yaml:"driver"`       // e.g., "postgres"
-	URL         string   `yaml:"url"`          // Database connection URL
-	URLFile     string   `yaml:"url_file"`     // File containing database connection URL
-	Table       string   `yaml:"table"`        // Table name
-	KeyColumn   string   `yaml:"key_column"`   // Column to search by (e.g., "uid")
-	ColumnNames []string `yaml:"column_names"` // Mapping of column names to template variables
-	Template    string   `yaml:"template"`     // Path to the template file
+	Driver           string            `yaml:"driver"`             // e.g., "postgres"
+	URL              string            `yaml:"url"`                // Database connection URL
+	URLFile          string            `yaml:"url_file"`           // File containing database connection URL
+	Table            string            `yaml:"table"`              // Table name
+	KeyColumn        string            `yaml:"key_column"`         // Column to search by (e.g., "uid")
+	ColumnNames      []string          `yaml:"column_names"`       // Mapping of column names to template variables
+	Query            string            `yaml:"query"`              // Custom query, used in place of table/key_column/column_names
+	LinksQuery       string            `yaml:"links_query"`        // Query whose rows are available to the template as `links`
+	Template         string            `yaml:"template"`           // Path to the template file
+	MaxOpenConns     int               `yaml:"max_open_conns"`     // Maximum number of open connections
+	MaxIdleConns     int               `yaml:"max_idle_conns"`     // Maximum number of idle connections
+	ConnMaxLifetime  time.Duration     `yaml:"conn_max_lifetime"`  // Maximum time a connection may be reused
+	ConnMaxIdleTime  time.Duration     `yaml:"conn_max_idle_time"` // Maximum time a connection may sit idle
+	ConnectTimeout   time.Duration     `yaml:"connect_timeout"`    // How long to retry connecting on startup
+	AliasColumn      string            `yaml:"alias_column"`       // Column searched when resolving aliases
+	AliasQuery       string            `yaml:"alias_query"`        // Custom query resolving an alias to its account
+	CountQuery       string            `yaml:"count_query"`        // Custom query counting users, for NodeInfo
+	OpenPGPKeyColumn string            `yaml:"openpgp_key_column"` // Column holding the user's binary OpenPGP key
+	OpenPGPKeyQuery  string            `yaml:"openpgp_key_query"`  // Custom query returning the user's binary OpenPGP key
+	ResourcePatterns []ResourcePattern `yaml:"resource_patterns"`
+}
+
+type AvatarConfiguration struct {
+	BaseURL string        `yaml:"base_url"` // Public URL the avatar endpoint is served under
+	MaxAge  time.Duration `yaml:"max_age"`  // Cache-Control max-age for avatar responses
+}
+
+type OpenIDConfiguration struct {
+	Issuer        string            `yaml:"issuer"`                   // Issuer for resources of any domain
+	Issuers       map[string]string `yaml:"issuers"`                  // Issuers for specific domains
+	AnswerUnknown bool              `yaml:"answer_unknown_resources"` // Answer issuer queries for unknown resources
+}
+
+type FediverseConfiguration struct {
+	ActorURL     string `yaml:"actor_url"`     // Template of the ActivityPub actor URL
+	ProfileURL   string `yaml:"profile_url"`   // Template of the HTML profile page URL
+	SubscribeURL string `yaml:"subscribe_url"` // Template of the remote follow URL, containing `{uri}`
+}
+
+type DomainAlias struct {
+	From   string `yaml:"from"`   // Domain that is no longer canonical
+	To     string `yaml:"to"`     // Domain that resources are now served under
+	Mode   string `yaml:"mode"`   // "rewrite" (default) or "redirect"
+	Status int    `yaml:"status"` // Redirect status, 301 (default) or 307
+}
+
+const (
+	DomainAliasRewrite  = "rewrite"
+	DomainAliasRedirect = "redirect"
+)
+
+type NodeInfoSoftware struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	Repository string `yaml:"repository"`
+	Homepage   string `yaml:"homepage"`
+}
+
+type NodeInfoServices struct {
+	Inbound  []string `yaml:"inbound"`
+	Outbound []string `yaml:"outbound"`
+}
+
+type NodeInfoUsers struct {
+	Total          *int `yaml:"total"`
+	ActiveHalfyear *int `yaml:"active_halfyear"`
+	ActiveMonth    *int `yaml:"active_month"`
+}
+
+type NodeInfoUsage struct {
+	Users         NodeInfoUsers `yaml:"users"`
+	LocalPosts    *int          `yaml:"local_posts"`
+	LocalComments *int          `yaml:"local_comments"`
+}
+
+type NodeInfoConfiguration struct {
+	BaseURL           string           `yaml:"base_url"` // Public URL of carpal, defaults to the request's host
+	Software          NodeInfoSoftware `yaml:"software"`
+	Protocols         []string         `yaml:"protocols"`
+	Services          NodeInfoServices `yaml:"services"`
+	OpenRegistrations bool             `yaml:"open_registrations"`
+	Usage             NodeInfoUsage    `yaml:"usage"`
+	Metadata          map[string]any   `yaml:"metadata"`
+	CountUsers        bool             `yaml:"count_users"`     // Count the total users via the driver
+	CountCacheTTL     time.Duration    `yaml:"count_cache_ttl"` // How long user counts are cached for
+}
+
+type NostrConfiguration struct {
+	Domain         string `yaml:"domain"`          // Domain of the looked up accounts, defaults to the request's host
+	PubkeyProperty string `yaml:"pubkey_property"` // Resource property holding the hex public key
+	RelaysProperty string `yaml:"relays_property"` // Resource property holding the list of relays
+}
+
+type WKDConfiguration struct {
+	Policy string `yaml:"policy"` // Contents of the WKD policy file
+}
+
+type MatrixConfiguration struct {
+	Server            string         `yaml:"server"`              // Delegated server name, e.g. `matrix.foobar.com:443`
+	HomeserverURL     string         `yaml:"homeserver_url"`      // Base URL of the homeserver for clients
+	IdentityServerURL string         `yaml:"identity_server_url"` // Base URL of the identity server for clients
+	Client            map[string]any `yaml:"client"`              // Additional properties of the client document
+}
+
+type AtprotoConfiguration struct {
+	DIDs        map[string]string `yaml:"dids"`         // DIDs of whole hosts, keyed by host
+	UserDomain  string            `yaml:"user_domain"`  // Domain whose subdomains are user handles, e.g. `bob.foobar.com`
+	DIDProperty string            `yaml:"did_property"` // Resource property holding the DID of a user
+}
+
+type LightningConfiguration struct {
+	Domain     string        `yaml:"domain"`      // Domain of the looked up accounts, defaults to the request's host
+	Template   string        `yaml:"template"`    // Template of the static LNURL-pay response
+	BackendURL string        `yaml:"backend_url"` // Template of the LNURL backend URL requests are proxied to
+	Timeout    time.Duration `yaml:"timeout"`     // Timeout of requests to the backend
+}
+
+type TLSCertificate struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+type TLSConfiguration struct {
+	CertFile       string           `yaml:"cert_file"`
+	KeyFile        string           `yaml:"key_file"`
+	Certificates   []TLSCertificate `yaml:"certificates"`    // Additional certificates, selected by SNI
+	MinVersion     string           `yaml:"min_version"`     // Minimum TLS version, e.g. `1.3`
+	ReloadInterval time.Duration    `yaml:"reload_interval"` // How often certificate files are checked for changes
+	RedirectPort   string           `yaml:"redirect_port"`   // Port of an HTTP listener redirecting to HTTPS
+	HTTPSPort      string           `yaml:"https_port"`      // Port redirects point to, defaults to the port listened on
+}
+
+type ServerConfiguration struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout"`        // Maximum duration for reading a whole request
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // Maximum duration for reading request headers
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // Maximum duration for writing a response
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // How long idle keep-alive connections are kept open
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`    // Maximum size of request headers
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`    // How long in-flight requests are drained for on shutdown
+	Listen            []string      `yaml:"listen"`              // Addresses to listen on, e.g. `unix:/run/carpal.sock` or `tcp://[::1]:8008`
+	SocketMode        string        `yaml:"socket_mode"`         // Permissions of Unix sockets listened on, e.g. `0660`
+}
+
+type MetricsConfiguration struct {
+	Port string `yaml:"port"` // Separate admin port to serve metrics on, defaults to the main port
+	Path string `yaml:"path"` // Path metrics are served on, defaults to `/metrics`
+}
+
+type HealthConfiguration struct {
+	Timeout  time.Duration `yaml:"timeout"`   // Timeout of each readiness check
+	CacheTTL time.Duration `yaml:"cache_ttl"` // How long readiness results are cached for
+}
+
+const (
+	AccessLogJSON     = "json"
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
+// AccessLogFields are the fields which can be included in JSON access logs.
+var AccessLogFields = []string{
+	"remote_addr",
+	"method",
+	"host",
+	"path",
+	"query",
+	"protocol",
+	"status",
+	"bytes",
+	"duration_ms",
+	"user_agent",
+	"referer",
+}
+
+type AccessLogConfiguration struct {
+	Format string   `yaml:"format"` // One of `json`, `common` or `combined`
+	Fields []string `yaml:"fields"` // Fields included in JSON access logs
+}
+
+type RateLimitConfiguration struct {
+	Requests         int           `yaml:"requests"`           // Requests allowed per client and window
+	Window           time.Duration `yaml:"window"`             // Window requests are counted over, defaults to a minute
+	Burst            int           `yaml:"burst"`              // Requests allowed at once, defaults to requests
+	NotFoundRequests int           `yaml:"not_found_requests"` // Not found responses allowed per client and window
+	NotFoundBurst    int           `yaml:"not_found_burst"`    // Not found responses allowed at once, defaults to not_found_requests
+	Allow            []string      `yaml:"allow"`              // Clients exempt from rate limiting, as IP addresses or CIDRs
+}
+
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+)
+
+type TracingConfiguration struct {
+	Exporter    string            `yaml:"exporter"`     // One of `otlp`, `stdout` or `file`
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP endpoint, e.g. `localhost:4318`
+	Insecure    bool              `yaml:"insecure"`     // Export over plain HTTP instead of HTTPS
+	Headers     map[string]string `yaml:"headers"`      // Headers sent with every OTLP export, e.g. for authentication
+	File        string            `yaml:"file"`         // File spans are written to by the `file` exporter
+	ServiceName string            `yaml:"service_name"` // Defaults to `carpal`
+	SampleRatio *float64          `yaml:"sample_ratio"` // Ratio of traces sampled, defaults to all of them
+}
+
+type CacheConfiguration struct {
+	MaxAge         time.Duration `yaml:"max_age"`           // Cache-Control max-age for found resources
+	NotFoundMaxAge time.Duration `yaml:"not_found_max_age"` // Cache-Control max-age for not found resources
+}
+
+const (
+	CompressionGzip   = "gzip"
+	CompressionBrotli = "br"
+	CompressionZstd   = "zstd"
+)
+
+type CompressionConfiguration struct {
+	Encodings []string `yaml:"encodings"` // Encodings in order of preference, defaults to `gzip`
+	MinSize   int      `yaml:"min_size"`  // Smallest response body compressed, in bytes
 }
 
 type Configuration struct {
-	Driver                string                 `yaml:"driver"`
-	FileConfiguration     *FileConfiguration     `yaml:"file"`
-	LDAPConfiguration     *LDAPConfiguration     `yaml:"ldap"`
-	DatabaseConfiguration *DatabaseConfiguration `yaml:"database"`
+	Driver                   string                    `yaml:"driver"`
+	FileConfiguration        *FileConfiguration        `yaml:"file"`
+	LDAPConfiguration        *LDAPConfiguration        `yaml:"ldap"`
+	DatabaseConfiguration    *DatabaseConfiguration    `yaml:"database"`
+	AvatarConfiguration      *AvatarConfiguration      `yaml:"avatar"`
+	OpenIDConfiguration      *OpenIDConfiguration      `yaml:"openid_connect"`
+	FediverseConfiguration   *FediverseConfiguration   `yaml:"fediverse"`
+	DomainAliases            []DomainAlias             `yaml:"domain_aliases"`
+	NodeInfoConfiguration    *NodeInfoConfiguration    `yaml:"nodeinfo"`
+	NostrConfiguration       *NostrConfiguration       `yaml:"nostr"`
+	WKDConfiguration         *WKDConfiguration         `yaml:"wkd"`
+	MatrixConfiguration      *MatrixConfiguration      `yaml:"matrix"`
+	AtprotoConfiguration     *AtprotoConfiguration     `yaml:"atproto"`
+	LightningConfiguration   *LightningConfiguration   `yaml:"lightning"`
+	TLSConfiguration         *TLSConfiguration         `yaml:"tls"`
+	ServerConfiguration      ServerConfiguration       `yaml:"server"`
+	MetricsConfiguration     *MetricsConfiguration     `yaml:"metrics"`
+	HealthConfiguration      *HealthConfiguration      `yaml:"health"`
+	AccessLogConfiguration   *AccessLogConfiguration   `yaml:"access_log"`
+	TrustedProxies           []string                  `yaml:"trusted_proxies"` // Proxies whose X-Forwarded-For headers are trusted
+	RateLimitConfiguration   *RateLimitConfiguration   `yaml:"rate_limit"`
+	TracingConfiguration     *TracingConfiguration     `yaml:"tracing"`
+	CacheConfiguration       *CacheConfiguration       `yaml:"cache"`
+	CompressionConfiguration *CompressionConfiguration `yaml:"compression"`
 }
 
 func (wiz configWizard) readConfigFile() ([]byte, error) {
@@ -106,6 +384,66 @@ func (wiz configWizard) processConfigYaml(
 		return nil, err
 	}
 
+	if err := wiz.processLDAPFailover(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processResourcePatterns(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processDomainAliases(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processFediverse(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processNostr(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processAtproto(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processLightning(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processTLS(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processAccessLog(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processTrustedProxies(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processRateLimit(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processTracing(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processCache(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processCompression(config); err != nil {
+		return nil, err
+	}
+
+	if err := wiz.processListen(config); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -166,6 +504,393 @@ func (wiz configWizard) processDatabaseURL(config *Configuration) error {
 	return nil
 }
 
+func (wiz configWizard) processLDAPFailover(config *Configuration) error {
+	if config.LDAPConfiguration == nil {
+		return nil
+	}
+
+	switch config.LDAPConfiguration.Failover {
+	case "", LDAPFailoverOrdered, LDAPFailoverRoundRobin:
+	default:
+		return fmt.Errorf(
+			"invalid LDAP failover strategy `%s`, must be `%s` or `%s`",
+			config.LDAPConfiguration.Failover,
+			LDAPFailoverOrdered,
+			LDAPFailoverRoundRobin,
+		)
+	}
+
+	if config.LDAPConfiguration.URL == "" && len(config.LDAPConfiguration.URLs) == 0 {
+		return fmt.Errorf("must specify at least one LDAP server in url or urls")
+	}
+
+	if config.LDAPConfiguration.MaxReferralHops < 0 {
+		return fmt.Errorf("max_referral_hops must not be negative")
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processResourcePatterns(config *Configuration) error {
+	patterns := []ResourcePattern{}
+	if config.FileConfiguration != nil {
+		patterns = append(patterns, config.FileConfiguration.ResourcePatterns...)
+	}
+	if config.LDAPConfiguration != nil {
+		patterns = append(patterns, config.LDAPConfiguration.ResourcePatterns...)
+	}
+	if config.DatabaseConfiguration != nil {
+		patterns = append(patterns, config.DatabaseConfiguration.ResourcePatterns...)
+	}
+
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern.Match); err != nil {
+			return fmt.Errorf("invalid resource pattern `%s`: %w", pattern.Match, err)
+		}
+
+		if pattern.Resource == "" {
+			return fmt.Errorf("resource pattern `%s` must specify a resource", pattern.Match)
+		}
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processDomainAliases(config *Configuration) error {
+	for i := range config.DomainAliases {
+		alias := &config.DomainAliases[i]
+
+		if alias.From == "" || alias.To == "" {
+			return fmt.Errorf("domain aliases must specify both from and to")
+		}
+
+		switch alias.Mode {
+		case "":
+			alias.Mode = DomainAliasRewrite
+		case DomainAliasRewrite, DomainAliasRedirect:
+		default:
+			return fmt.Errorf(
+				"invalid domain alias mode `%s`, must be `%s` or `%s`",
+				alias.Mode,
+				DomainAliasRewrite,
+				DomainAliasRedirect,
+			)
+		}
+
+		switch alias.Status {
+		case 0:
+			alias.Status = http.StatusMovedPermanently
+		case http.StatusMovedPermanently, http.StatusTemporaryRedirect:
+		default:
+			return fmt.Errorf("invalid domain alias redirect status %d, must be 301 or 307", alias.Status)
+		}
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processFediverse(config *Configuration) error {
+	if config.FediverseConfiguration == nil {
+		return nil
+	}
+
+	fediverse := config.FediverseConfiguration
+
+	if err := parseTemplate("fediverse actor_url", fediverse.ActorURL); err != nil {
+		return err
+	}
+
+	if err := parseTemplate("fediverse profile_url", fediverse.ProfileURL); err != nil {
+		return err
+	}
+
+	return parseTemplate("fediverse subscribe_url", fediverse.SubscribeURL)
+}
+
+func (wiz configWizard) processNostr(config *Configuration) error {
+	if config.NostrConfiguration == nil {
+		return nil
+	}
+
+	if config.NostrConfiguration.PubkeyProperty == "" {
+		return fmt.Errorf("must specify nostr pubkey_property")
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processAtproto(config *Configuration) error {
+	if config.AtprotoConfiguration == nil {
+		return nil
+	}
+
+	if config.AtprotoConfiguration.UserDomain != "" && config.AtprotoConfiguration.DIDProperty == "" {
+		return fmt.Errorf("must specify atproto did_property to serve DIDs of users")
+	}
+
+	for host, did := range config.AtprotoConfiguration.DIDs {
+		if !strings.HasPrefix(did, "did:") {
+			return fmt.Errorf("invalid atproto DID `%s` for host `%s`", did, host)
+		}
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processLightning(config *Configuration) error {
+	if config.LightningConfiguration == nil {
+		return nil
+	}
+
+	hasTemplate := config.LightningConfiguration.Template != ""
+	hasBackendURL := config.LightningConfiguration.BackendURL != ""
+
+	if hasTemplate == hasBackendURL {
+		return fmt.Errorf("must specify either lightning template or backend_url")
+	}
+
+	if hasTemplate {
+		return parseTemplate("lightning", config.LightningConfiguration.Template)
+	}
+
+	return parseTemplate("lightning backend_url", config.LightningConfiguration.BackendURL)
+}
+
+// parseTemplate checks that a configured template parses, so that mistakes
+// are reported when the configuration is loaded rather than when it is used.
+func parseTemplate(name string, text string) error {
+	if _, err := template.New(name).Parse(text); err != nil {
+		return fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	return nil
+}
+
+// processTLS moves the top-level certificate pair into the list of
+// certificates, so that every pair can be handled the same way.
+func (wiz configWizard) processTLS(config *Configuration) error {
+	if config.TLSConfiguration == nil {
+		return nil
+	}
+
+	tlsConf := config.TLSConfiguration
+
+	if (tlsConf.CertFile == "") != (tlsConf.KeyFile == "") {
+		return fmt.Errorf("must specify both tls cert_file and key_file")
+	}
+
+	if tlsConf.CertFile != "" {
+		tlsConf.Certificates = append(
+			[]TLSCertificate{{CertFile: tlsConf.CertFile, KeyFile: tlsConf.KeyFile}},
+			tlsConf.Certificates...,
+		)
+	}
+
+	if len(tlsConf.Certificates) == 0 {
+		return fmt.Errorf("must specify at least one tls certificate")
+	}
+
+	for _, certificate := range tlsConf.Certificates {
+		if certificate.CertFile == "" || certificate.KeyFile == "" {
+			return fmt.Errorf("tls certificates must specify both cert_file and key_file")
+		}
+	}
+
+	switch tlsConf.MinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return fmt.Errorf("invalid tls min_version `%s`, must be one of 1.0, 1.1, 1.2 or 1.3", tlsConf.MinVersion)
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processAccessLog(config *Configuration) error {
+	if config.AccessLogConfiguration == nil {
+		return nil
+	}
+
+	accessLog := config.AccessLogConfiguration
+
+	switch accessLog.Format {
+	case "":
+		accessLog.Format = AccessLogJSON
+	case AccessLogJSON, AccessLogCommon, AccessLogCombined:
+	default:
+		return fmt.Errorf(
+			"invalid access log format `%s`, must be `%s`, `%s` or `%s`",
+			accessLog.Format,
+			AccessLogJSON,
+			AccessLogCommon,
+			AccessLogCombined,
+		)
+	}
+
+	if len(accessLog.Fields) == 0 {
+		accessLog.Fields = slices.Clone(AccessLogFields)
+	}
+
+	for _, field := range accessLog.Fields {
+		if !slices.Contains(AccessLogFields, field) {
+			return fmt.Errorf("invalid access log field `%s`", field)
+		}
+	}
+
+	return nil
+}
+
+// processTrustedProxies normalizes every trusted proxy to a CIDR, so that
+// single addresses can be given as well.
+func (wiz configWizard) processTrustedProxies(config *Configuration) error {
+	return normalizeCIDRs(config.TrustedProxies, "trusted proxy")
+}
+
+func (wiz configWizard) processRateLimit(config *Configuration) error {
+	if config.RateLimitConfiguration == nil {
+		return nil
+	}
+
+	rateLimit := config.RateLimitConfiguration
+
+	if rateLimit.Requests <= 0 {
+		return fmt.Errorf("must specify a positive number of rate_limit requests")
+	}
+
+	if rateLimit.NotFoundRequests < 0 {
+		return fmt.Errorf("rate_limit not_found_requests must not be negative")
+	}
+
+	if rateLimit.Burst < 0 {
+		return fmt.Errorf("rate_limit burst must not be negative")
+	}
+
+	if rateLimit.NotFoundBurst < 0 {
+		return fmt.Errorf("rate_limit not_found_burst must not be negative")
+	}
+
+	if rateLimit.Window < 0 {
+		return fmt.Errorf("rate_limit window must not be negative")
+	}
+
+	return normalizeCIDRs(rateLimit.Allow, "rate limit allow-list entry")
+}
+
+func (wiz configWizard) processTracing(config *Configuration) error {
+	if config.TracingConfiguration == nil {
+		return nil
+	}
+
+	tracing := config.TracingConfiguration
+
+	switch tracing.Exporter {
+	case "":
+		tracing.Exporter = TracingExporterOTLP
+	case TracingExporterOTLP, TracingExporterStdout:
+	case TracingExporterFile:
+		if tracing.File == "" {
+			return fmt.Errorf("must specify tracing file for the file exporter")
+		}
+	default:
+		return fmt.Errorf(
+			"invalid tracing exporter `%s`, must be `%s`, `%s` or `%s`",
+			tracing.Exporter,
+			TracingExporterOTLP,
+			TracingExporterStdout,
+			TracingExporterFile,
+		)
+	}
+
+	if tracing.SampleRatio != nil && (*tracing.SampleRatio < 0 || *tracing.SampleRatio > 1) {
+		return fmt.Errorf("tracing sample_ratio must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processCache(config *Configuration) error {
+	if config.CacheConfiguration == nil {
+		return nil
+	}
+
+	if config.CacheConfiguration.MaxAge < 0 || config.CacheConfiguration.NotFoundMaxAge < 0 {
+		return fmt.Errorf("cache max_age and not_found_max_age must not be negative")
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processCompression(config *Configuration) error {
+	if config.CompressionConfiguration == nil {
+		return nil
+	}
+
+	compression := config.CompressionConfiguration
+
+	if len(compression.Encodings) == 0 {
+		compression.Encodings = []string{CompressionGzip}
+	}
+
+	for _, encoding := range compression.Encodings {
+		switch encoding {
+		case CompressionGzip, CompressionBrotli, CompressionZstd:
+		default:
+			return fmt.Errorf(
+				"invalid compression encoding `%s`, must be `%s`, `%s` or `%s`",
+				encoding,
+				CompressionGzip,
+				CompressionBrotli,
+				CompressionZstd,
+			)
+		}
+	}
+
+	if compression.MinSize < 0 {
+		return fmt.Errorf("compression min_size must not be negative")
+	}
+
+	return nil
+}
+
+func (wiz configWizard) processListen(config *Configuration) error {
+	for _, address := range config.ServerConfiguration.Listen {
+		scheme, rest, ok := strings.Cut(address, ":")
+		if ok && scheme == "unix" && strings.TrimPrefix(rest, "//") == "" {
+			return fmt.Errorf("invalid listen address `%s`, must name a socket path", address)
+		}
+
+		if ok && scheme != "unix" && scheme != "tcp" && strings.HasPrefix(rest, "//") {
+			return fmt.Errorf("invalid listen address `%s`, must be a `unix:` or `tcp://` address", address)
+		}
+	}
+
+	if mode := config.ServerConfiguration.SocketMode; mode != "" {
+		if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+			return fmt.Errorf("invalid server socket_mode `%s`, must be an octal mode like `0660`", mode)
+		}
+	}
+
+	return nil
+}
+
+// normalizeCIDRs validates a list of IP addresses and CIDRs, replacing every
+// address with the CIDR matching only that address.
+func normalizeCIDRs(cidrs []string, description string) error {
+	for i, cidr := range cidrs {
+		if _, err := netip.ParsePrefix(cidr); err == nil {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid %s `%s`, must be an IP address or CIDR", description, cidr)
+		}
+
+		cidrs[i] = netip.PrefixFrom(addr, addr.BitLen()).String()
+	}
+
+	return nil
+}
+
 func (wiz configWizard) GetConfiguration() (*Configuration, error) {
 	configYaml, err := wiz.readConfigFile()
 	if err != nil {
@@ -40,6 +40,7 @@ func TestConfigWizardGetConfigurationWithLDAPBindPassFile(t *testing.T) {
 	testYaml := `
 driver: ldap
 ldap:
+  url: ldap://ldap.example.com
   bind_pass_file: ../../test/secret_file
 `
 	passwordContent := "test_secret"
@@ -236,3 +237,303 @@ func TestConfigWizardExpandEnvs(t *testing.T) {
 		}
 	})
 }
+
+func TestConfigWizardGetConfigurationWithInvalidLDAPFailover(t *testing.T) {
+	testYaml := `
+driver: ldap
+ldap:
+  bind_pass: password
+  urls:
+    - ldap://ldap1.example.com
+    - ldap://ldap2.example.com
+  failover: random
+`
+	wizard := configWizard{}
+	t.Run("config wizard errors on unknown LDAP failover strategy", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(testYaml))
+		if err == nil {
+			t.Fatal("expected error on unknown failover strategy")
+		}
+
+		if !strings.Contains(err.Error(), "invalid LDAP failover strategy") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithoutLDAPServers(t *testing.T) {
+	testYaml := `
+driver: ldap
+ldap:
+  bind_pass: password
+  basedn: dc=foobar,dc=com
+`
+	wizard := configWizard{}
+	t.Run("config wizard errors when no LDAP server is configured", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(testYaml))
+		if err == nil {
+			t.Fatal("expected error without LDAP servers")
+		}
+
+		if !strings.Contains(err.Error(), "must specify at least one LDAP server") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithInvalidResourcePattern(t *testing.T) {
+	testYaml := `
+driver: file
+file:
+  directory: /foo/bar
+  resource_patterns:
+    - match: '^https://foobar\.com/~(?P<user>[^/]+$'
+      resource: 'acct:${user}@foobar.com'
+`
+	wizard := configWizard{}
+	t.Run("config wizard errors on resource patterns that do not compile", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(testYaml))
+		if err == nil {
+			t.Fatal("expected error on invalid resource pattern")
+		}
+
+		if !strings.Contains(err.Error(), "invalid resource pattern") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithDomainAliases(t *testing.T) {
+	wizard := configWizard{}
+
+	t.Run("config wizard defaults domain aliases to permanent rewrites", func(t *testing.T) {
+		got, err := wizard.processConfigYaml([]byte(`
+driver: file
+domain_aliases:
+  - from: example.org
+    to: social.example.org
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []DomainAlias{
+			{From: "example.org", To: "social.example.org", Mode: DomainAliasRewrite, Status: 301},
+		}
+		if !cmp.Equal(got.DomainAliases, want) {
+			t.Errorf("got: %+v, want: %+v", got.DomainAliases, want)
+		}
+	})
+
+	t.Run("config wizard errors on unsupported redirect status", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+domain_aliases:
+  - from: example.org
+    to: social.example.org
+    mode: redirect
+    status: 302
+`))
+		if err == nil {
+			t.Fatal("expected error on unsupported redirect status")
+		}
+
+		if !strings.Contains(err.Error(), "invalid domain alias redirect status") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithInvalidFediverseTemplate(t *testing.T) {
+	testYaml := `
+driver: file
+fediverse:
+  actor_url: 'https://{{ .host }}/users/{{ .user }'
+`
+	wizard := configWizard{}
+	t.Run("config wizard errors on fediverse templates that do not parse", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(testYaml))
+		if err == nil {
+			t.Fatal("expected error on invalid fediverse template")
+		}
+
+		if !strings.Contains(err.Error(), "invalid fediverse actor_url template") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithInvalidLightningTemplate(t *testing.T) {
+	wizard := configWizard{}
+
+	t.Run("config wizard errors on lightning templates that do not parse", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+lightning:
+  template: 'callback: https://pay.foobar.com/{{ .user'
+`))
+		if err == nil {
+			t.Fatal("expected error on invalid lightning template")
+		}
+
+		if !strings.Contains(err.Error(), "invalid lightning template") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+
+	t.Run("config wizard errors on lightning backend urls that do not parse", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+lightning:
+  backend_url: 'https://lnbits.foobar.com/lnurlp/{{ .user }'
+`))
+		if err == nil {
+			t.Fatal("expected error on invalid lightning backend_url")
+		}
+
+		if !strings.Contains(err.Error(), "invalid lightning backend_url template") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithInvalidRateLimit(t *testing.T) {
+	wizard := configWizard{}
+
+	for _, field := range []string{"burst: -1", "not_found_burst: -1", "window: -1m"} {
+		name, _, _ := strings.Cut(field, ":")
+
+		t.Run("config wizard errors on negative rate limit "+name, func(t *testing.T) {
+			_, err := wizard.processConfigYaml([]byte(`
+driver: file
+rate_limit:
+  requests: 60
+  not_found_requests: 10
+  ` + field + `
+`))
+			if err == nil {
+				t.Fatalf("expected error on negative %s", name)
+			}
+
+			if !strings.Contains(err.Error(), "rate_limit "+name+" must not be negative") {
+				t.Errorf("unexpected error message: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigWizardGetConfigurationWithTLS(t *testing.T) {
+	wizard := configWizard{}
+
+	t.Run("config wizard lists the top-level certificate first", func(t *testing.T) {
+		got, err := wizard.processConfigYaml([]byte(`
+driver: file
+tls:
+  cert_file: /etc/carpal/foobar.crt
+  key_file: /etc/carpal/foobar.key
+  certificates:
+    - cert_file: /etc/carpal/example.crt
+      key_file: /etc/carpal/example.key
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []TLSCertificate{
+			{CertFile: "/etc/carpal/foobar.crt", KeyFile: "/etc/carpal/foobar.key"},
+			{CertFile: "/etc/carpal/example.crt", KeyFile: "/etc/carpal/example.key"},
+		}
+		if !cmp.Equal(got.TLSConfiguration.Certificates, want) {
+			t.Errorf("got: %+v, want: %+v", got.TLSConfiguration.Certificates, want)
+		}
+	})
+
+	t.Run("config wizard errors on unknown TLS versions", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+tls:
+  cert_file: /etc/carpal/foobar.crt
+  key_file: /etc/carpal/foobar.key
+  min_version: "1.4"
+`))
+		if err == nil {
+			t.Fatal("expected error on unknown TLS version")
+		}
+
+		if !strings.Contains(err.Error(), "invalid tls min_version") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithCompression(t *testing.T) {
+	wizard := configWizard{}
+
+	t.Run("config wizard defaults compression to gzip", func(t *testing.T) {
+		got, err := wizard.processConfigYaml([]byte(`
+driver: file
+compression:
+  min_size: 512
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !cmp.Equal(got.CompressionConfiguration.Encodings, []string{CompressionGzip}) {
+			t.Errorf("got: %+v", got.CompressionConfiguration.Encodings)
+		}
+	})
+
+	t.Run("config wizard errors on unknown encodings", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+compression:
+  encodings: [br, deflate]
+`))
+		if err == nil {
+			t.Fatal("expected error on unknown encoding")
+		}
+
+		if !strings.Contains(err.Error(), "invalid compression encoding `deflate`") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+}
+
+func TestConfigWizardGetConfigurationWithListenAddresses(t *testing.T) {
+	wizard := configWizard{}
+
+	t.Run("config wizard accepts unix and tcp addresses", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+server:
+  listen: ["unix:/run/carpal.sock", "tcp://[::1]:8008", ":8008"]
+  socket_mode: "0660"
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("config wizard errors on unknown address schemes", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+server:
+  listen: ["udp://[::1]:8008"]
+`))
+		if err == nil || !strings.Contains(err.Error(), "invalid listen address") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("config wizard errors on non-octal socket modes", func(t *testing.T) {
+		_, err := wizard.processConfigYaml([]byte(`
+driver: file
+server:
+  socket_mode: "rw-rw----"
+`))
+		if err == nil || !strings.Contains(err.Error(), "invalid server socket_mode") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/metrics"
+	"github.com/peeley/carpal/internal/resource"
+	"gopkg.in/yaml.v3"
+)
+
+// aliasIndex maps the aliases listed in each resource file to the subject of
+// that file. The index is rebuilt whenever files are added to or removed from
+// the resource directory.
+type aliasIndex struct {
+	mu       sync.Mutex
+	built    bool
+	modTime  time.Time
+	subjects map[string]string
+}
+
+func newAliasIndex() *aliasIndex {
+	return &aliasIndex{subjects: make(map[string]string)}
+}
+
+func (idx *aliasIndex) lookup(directory string, alias string, forceRebuild bool) (string, bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	info, err := os.Stat(directory)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read resource directory: %w", err)
+	}
+
+	if forceRebuild || !idx.built || !info.ModTime().Equal(idx.modTime) {
+		if err := idx.rebuild(directory); err != nil {
+			return "", false, err
+		}
+		idx.built = true
+		idx.modTime = info.ModTime()
+	}
+
+	subject, ok := idx.subjects[alias]
+	return subject, ok, nil
+}
+
+func (idx *aliasIndex) rebuild(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return fmt.Errorf("unable to read resource directory: %w", err)
+	}
+
+	subjects := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		contents, err := os.ReadFile(path.Join(directory, entry.Name()))
+		if err != nil {
+			slog.Warn("unable to read resource file while indexing aliases", "file", entry.Name(), "err", err)
+			continue
+		}
+
+		var res resource.Resource
+		if err := yaml.Unmarshal(contents, &res); err != nil {
+			slog.Warn("unable to unmarshal resource file while indexing aliases", "file", entry.Name(), "err", err)
+			continue
+		}
+
+		for _, alias := range res.Aliases {
+			if existing, ok := subjects[alias]; ok {
+				slog.Warn("alias is listed by multiple resources", "alias", alias, "resources", []string{existing, entry.Name()})
+				continue
+			}
+			subjects[alias] = entry.Name()
+		}
+	}
+
+	slog.Debug("rebuilt alias index", "aliases", len(subjects))
+	metrics.SetAliasIndexEntries(len(subjects))
+	idx.subjects = subjects
+
+	return nil
+}
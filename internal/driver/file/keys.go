@@ -0,0 +1,73 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/wkd"
+)
+
+// keyIndex maps the WKD hash and host of every address in the OpenPGP key
+// directory to that address, for clients looking keys up by hash alone. Like
+// the alias index, it is rebuilt whenever files are added to or removed from
+// the directory.
+type keyIndex struct {
+	mu        sync.Mutex
+	built     bool
+	modTime   time.Time
+	addresses map[string]string
+}
+
+func newKeyIndex() *keyIndex {
+	return &keyIndex{addresses: make(map[string]string)}
+}
+
+func (idx *keyIndex) lookup(directory string, hash string, host string) (string, bool, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	info, err := os.Stat(directory)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to read key directory: %w", err)
+	}
+
+	if !idx.built || !info.ModTime().Equal(idx.modTime) {
+		if err := idx.rebuild(directory); err != nil {
+			return "", false, err
+		}
+		idx.built = true
+		idx.modTime = info.ModTime()
+	}
+
+	address, ok := idx.addresses[hash+"@"+strings.ToLower(host)]
+	return address, ok, nil
+}
+
+func (idx *keyIndex) rebuild(directory string) error {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return fmt.Errorf("unable to read key directory: %w", err)
+	}
+
+	addresses := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		at := strings.LastIndex(entry.Name(), "@")
+		if at == -1 {
+			continue
+		}
+
+		localPart, host := entry.Name()[:at], strings.ToLower(entry.Name()[at+1:])
+		addresses[wkd.Hash(localPart)+"@"+host] = entry.Name()
+	}
+
+	idx.addresses = addresses
+
+	return nil
+}
@@ -1,32 +1,74 @@
 package file
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/peeley/carpal/internal/config"
 	"github.com/peeley/carpal/internal/driver"
 	"github.com/peeley/carpal/internal/resource"
+	"github.com/peeley/carpal/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 )
 
 type fileDriver struct {
 	Configuration config.Configuration
+	Aliases       *aliasIndex
+	Rewriter      driver.ResourceRewriter
+	Keys          *keyIndex
 }
 
 func NewFileDriver(config config.Configuration) driver.Driver {
 	return fileDriver{
 		config,
+		newAliasIndex(),
+		driver.NewResourceRewriter(config.FileConfiguration.ResourcePatterns),
+		newKeyIndex(),
 	}
 }
 
-func (d fileDriver) GetResource(name string) (*resource.Resource, error) {
+func (d fileDriver) GetResource(ctx context.Context, name string) (*resource.Resource, error) {
+	return d.Rewriter.Resolve(name, func(name string) (*resource.Resource, error) {
+		return d.lookup(ctx, name)
+	})
+}
+
+func (d fileDriver) Name() string {
+	return "file"
+}
+
+func (d fileDriver) lookup(ctx context.Context, name string) (*resource.Resource, error) {
+	// resource names containing a slash, like `https://` URIs, can never be a
+	// file in the resource directory, but may still be an alias.
+	if !strings.Contains(name, "/") {
+		resource, err := d.readResource(ctx, name)
+		if err == nil || !errors.As(err, &driver.ResourceNotFound{}) {
+			return resource, err
+		}
+	}
+
+	if !d.Configuration.FileConfiguration.IndexAliases {
+		return nil, driver.ResourceNotFound{ResourceName: name}
+	}
+
+	return d.getResourceByAlias(ctx, name)
+}
+
+func (d fileDriver) readResource(ctx context.Context, name string) (*resource.Resource, error) {
 	baseDirectory := path.Clean(d.Configuration.FileConfiguration.Directory)
 
-	resourceFile, err := os.ReadFile(path.Join(baseDirectory, name))
+	_, span := tracing.Start(ctx, "file.read", attribute.String("file.name", name))
+	resourceFile, modTime, err := readFile(path.Join(baseDirectory, name))
+	tracing.End(span, err)
 	if err != nil {
 		slog.Error("unable to read resource file", "err", err)
 		if errors.Is(err, os.ErrNotExist) {
@@ -36,14 +78,132 @@ func (d fileDriver) GetResource(name string) (*resource.Resource, error) {
 		}
 	}
 
+	_, span = tracing.Start(ctx, "yaml.unmarshal")
 	var resource resource.Resource
 	err = yaml.Unmarshal(resourceFile, &resource)
+	tracing.End(span, err)
 	if err != nil {
 		slog.Error("unable to unmarshal resource file contents", "err", err)
 		return nil, fmt.Errorf("could not unmarshal file to JRD: %w", err)
 	}
 
 	resource.Subject = name
+	resource.ModTime = modTime
 
 	return &resource, nil
 }
+
+// readFile returns the contents of the file along with its modification time.
+func readFile(name string) ([]byte, time.Time, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	contents, err := io.ReadAll(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return contents, info.ModTime(), nil
+}
+
+// getResourceByAlias returns the resource listing the given name as one of its
+// aliases. As resource files may have been edited since the index was built,
+// the index is rebuilt once if the indexed file no longer lists the alias.
+func (d fileDriver) getResourceByAlias(ctx context.Context, alias string) (*resource.Resource, error) {
+	baseDirectory := path.Clean(d.Configuration.FileConfiguration.Directory)
+
+	for _, forceRebuild := range []bool{false, true} {
+		subject, ok, err := d.Aliases.lookup(baseDirectory, alias, forceRebuild)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, driver.ResourceNotFound{ResourceName: alias}
+		}
+
+		resource, err := d.readResource(ctx, subject)
+		if err != nil && !errors.As(err, &driver.ResourceNotFound{}) {
+			return nil, err
+		}
+		if err == nil && slices.Contains(resource.Aliases, alias) {
+			return resource, nil
+		}
+	}
+
+	return nil, driver.ResourceNotFound{ResourceName: alias}
+}
+
+// CountUsers returns the number of resource files in the resource directory.
+func (d fileDriver) CountUsers() (int, error) {
+	entries, err := os.ReadDir(path.Clean(d.Configuration.FileConfiguration.Directory))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read resource directory: %w", err)
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CheckHealth checks that the resource directory is readable.
+func (d fileDriver) CheckHealth(ctx context.Context) error {
+	if _, err := os.ReadDir(path.Clean(d.Configuration.FileConfiguration.Directory)); err != nil {
+		return fmt.Errorf("unable to read resource directory: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpenPGPKey reads the binary key of the address from the key directory,
+// e.g. `bob@foobar.com`.
+func (d fileDriver) GetOpenPGPKey(user string, host string) ([]byte, error) {
+	address := user + "@" + host
+	keyDirectory := d.Configuration.FileConfiguration.OpenPGPKeyDirectory
+
+	if keyDirectory == "" || strings.ContainsAny(address, "/\\") || strings.HasPrefix(address, ".") {
+		return nil, driver.ResourceNotFound{ResourceName: address}
+	}
+
+	key, err := os.ReadFile(path.Join(path.Clean(keyDirectory), address))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, driver.ResourceNotFound{ResourceName: address}
+		}
+		return nil, fmt.Errorf("unable to read key file: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetOpenPGPKeyByHash reads the key of the address in the key directory whose
+// local part has the given WKD hash.
+func (d fileDriver) GetOpenPGPKeyByHash(hash string, host string) ([]byte, error) {
+	keyDirectory := d.Configuration.FileConfiguration.OpenPGPKeyDirectory
+	if keyDirectory == "" {
+		return nil, driver.ResourceNotFound{ResourceName: hash + "@" + host}
+	}
+
+	address, ok, err := d.Keys.lookup(path.Clean(keyDirectory), hash, host)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, driver.ResourceNotFound{ResourceName: hash + "@" + host}
+	}
+
+	at := strings.LastIndex(address, "@")
+	return d.GetOpenPGPKey(address[:at], address[at+1:])
+}
@@ -1,7 +1,10 @@
 package file
 
 import (
+	"context"
 	"errors"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -22,12 +25,17 @@ func TestFileDriverGetResource(t *testing.T) {
 
 	t.Run("can get resource from file", func(t *testing.T){
 
-		got, err := fileDriver.GetResource("acct:bob@foobar.com")
+		got, err := fileDriver.GetResource(context.Background(), "acct:bob@foobar.com")
 
 		if err != nil {
 			t.Fatal(err)
 		}
 
+		info, err := os.Stat("../../../test/acct:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		profilePage := "https://www.example.com/~bob/"
 		businessCard := "https://www.example.com/~bob/bob.vcf"
 		want := &resource.Resource{
@@ -44,6 +52,7 @@ func TestFileDriverGetResource(t *testing.T) {
 					Href: &businessCard,
 				},
 			},
+			ModTime: info.ModTime(),
 		}
 
 		if !cmp.Equal(got, want) {
@@ -52,7 +61,7 @@ func TestFileDriverGetResource(t *testing.T) {
 	})
 
 	t.Run("missing resource files should throw error", func(t *testing.T) {
-		resource, err := fileDriver.GetResource("missingno")
+		resource, err := fileDriver.GetResource(context.Background(), "missingno")
 
 		if err == nil {
 			t.Errorf("should have gotten error, instead got resource: %+v", resource)
@@ -63,3 +72,124 @@ func TestFileDriverGetResource(t *testing.T) {
 		}
 	})
 }
+
+func TestFileDriverGetResourceByAlias(t *testing.T) {
+	config := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory:    "../../../test/",
+			IndexAliases: true,
+		},
+	}
+
+	fileDriver := NewFileDriver(config)
+
+	t.Run("can get resource by one of its aliases", func(t *testing.T) {
+		for _, alias := range []string{"mailto:bob@foobar.com", "https://mastodon/bob"} {
+			got, err := fileDriver.GetResource(context.Background(), alias)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Subject != "acct:bob@foobar.com" {
+				t.Errorf("expected canonical subject, got: %v", got.Subject)
+			}
+		}
+	})
+
+	t.Run("unknown aliases should throw error", func(t *testing.T) {
+		resource, err := fileDriver.GetResource(context.Background(), "mailto:alice@foobar.com")
+
+		if !errors.As(err, &driver.ResourceNotFound{}) {
+			t.Errorf("error should be ResourceNotFound: %+v, %+v", err, resource)
+		}
+	})
+
+	t.Run("aliases are not resolved unless enabled", func(t *testing.T) {
+		fileConfig := *config.FileConfiguration
+		fileConfig.IndexAliases = false
+		withoutIndex := config
+		withoutIndex.FileConfiguration = &fileConfig
+		fileDriver := NewFileDriver(withoutIndex)
+
+		resource, err := fileDriver.GetResource(context.Background(), "mailto:bob@foobar.com")
+
+		if !errors.As(err, &driver.ResourceNotFound{}) {
+			t.Errorf("error should be ResourceNotFound: %+v, %+v", err, resource)
+		}
+	})
+}
+
+func TestFileDriverGetResourceByPattern(t *testing.T) {
+	config := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../../test/",
+			ResourcePatterns: []config.ResourcePattern{
+				{Match: `^https://www\.example\.com/~([^/]+)/$`, Resource: "acct:$1@foobar.com"},
+			},
+		},
+	}
+
+	fileDriver := NewFileDriver(config)
+
+	t.Run("can get resource by URL matching a pattern", func(t *testing.T) {
+		got, err := fileDriver.GetResource(context.Background(), "https://www.example.com/~bob/")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Subject != "acct:bob@foobar.com" {
+			t.Errorf("expected canonical subject, got: %v", got.Subject)
+		}
+	})
+}
+
+func TestFileDriverCountUsers(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"acct:alice@foobar.com", "acct:bob@foobar.com", ".hidden"} {
+		if err := os.WriteFile(path.Join(directory, name), []byte{}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fileDriver := NewFileDriver(config.Configuration{
+		Driver:            "file",
+		FileConfiguration: &config.FileConfiguration{Directory: directory},
+	})
+
+	t.Run("counts resource files", func(t *testing.T) {
+		got, err := fileDriver.(driver.UserCounter).CountUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != 2 {
+			t.Errorf("got: %v, want: 2", got)
+		}
+	})
+}
+
+func TestFileDriverCheckHealth(t *testing.T) {
+	t.Run("readable resource directory is healthy", func(t *testing.T) {
+		fileDriver := NewFileDriver(config.Configuration{
+			Driver:            "file",
+			FileConfiguration: &config.FileConfiguration{Directory: t.TempDir()},
+		})
+
+		if err := fileDriver.(driver.HealthChecker).CheckHealth(context.Background()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing resource directory is unhealthy", func(t *testing.T) {
+		fileDriver := NewFileDriver(config.Configuration{
+			Driver:            "file",
+			FileConfiguration: &config.FileConfiguration{Directory: path.Join(t.TempDir(), "missing")},
+		})
+
+		if err := fileDriver.(driver.HealthChecker).CheckHealth(context.Background()); err == nil {
+			t.Error("expected error for missing directory")
+		}
+	})
+}
@@ -2,15 +2,22 @@ package ldap
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"regexp"
+	"strings"
 	"text/template"
 
 	client "github.com/go-ldap/ldap/v3"
 	"github.com/peeley/carpal/internal/config"
 	"github.com/peeley/carpal/internal/driver"
 	"github.com/peeley/carpal/internal/resource"
+	"github.com/peeley/carpal/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,12 +25,22 @@ type LdapClient interface {
 	Bind(string, string) error
 	Close() error
 	Search(*client.SearchRequest) (*client.SearchResult, error)
+	SearchWithPaging(*client.SearchRequest, uint32) (*client.SearchResult, error)
 }
 
+const (
+	DEFAULT_MAX_REFERRAL_HOPS = 3
+	// DEFAULT_PAGE_SIZE stays below the size limits of common servers, e.g.
+	// Active Directory's MaxPageSize of 1000.
+	DEFAULT_PAGE_SIZE = 500
+)
+
 type ldapDriver struct {
 	Configuration config.Configuration
 	Template      *template.Template
-	ClientFunc    func() (LdapClient, error)
+	ClientFunc    func(string) (LdapClient, error)
+	Servers       *serverPool
+	Rewriter      driver.ResourceRewriter
 }
 
 func NewLDAPDriver(conf config.Configuration) driver.Driver {
@@ -31,13 +48,39 @@ func NewLDAPDriver(conf config.Configuration) driver.Driver {
 		Configuration: conf,
 	}
 	d.Template = template.Must(template.ParseFiles(conf.LDAPConfiguration.Template))
-	d.ClientFunc = func() (LdapClient, error) {
-		return client.DialURL(conf.LDAPConfiguration.URL)
+	d.ClientFunc = func(url string) (LdapClient, error) {
+		return client.DialURL(url)
 	}
+	d.Servers = newServerPool(conf.LDAPConfiguration)
+	d.Rewriter = driver.NewResourceRewriter(conf.LDAPConfiguration.ResourcePatterns)
 	return d
 }
 
-func (d ldapDriver) GetResource(name string) (*resource.Resource, error) {
+func (d ldapDriver) GetResource(ctx context.Context, name string) (*resource.Resource, error) {
+	return d.Rewriter.Resolve(name, func(name string) (*resource.Resource, error) {
+		return d.lookup(ctx, name)
+	})
+}
+
+func (d ldapDriver) Name() string {
+	return "ldap"
+}
+
+func (d ldapDriver) lookup(ctx context.Context, name string) (*resource.Resource, error) {
+	res, err := d.getResource(ctx, name)
+	if err == nil || d.Configuration.LDAPConfiguration.AliasAttr == "" || !errors.As(err, &driver.ResourceNotFound{}) {
+		return res, err
+	}
+
+	account, err := d.resolveAlias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.getResource(ctx, account)
+}
+
+func (d ldapDriver) getResource(ctx context.Context, name string) (*resource.Resource, error) {
 	var resource resource.Resource
 
 	re, err := regexp.Compile("acct:([^@]+)")
@@ -53,55 +96,405 @@ func (d ldapDriver) GetResource(name string) (*resource.Resource, error) {
 		return nil, errors.New("Error breaking down resource")
 	}
 	username := resourceName[1]
-	c, err := d.ClientFunc()
+	_, span := tracing.Start(ctx, "ldap.connect")
+	c, err := d.connect()
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 	defer c.Close()
-	err = c.Bind(d.Configuration.LDAPConfiguration.BindUser, d.Configuration.LDAPConfiguration.BindPass)
+
+	_, span = tracing.Start(ctx, "ldap.search", attribute.String("ldap.user", username))
+	ldapUser, err := d.findUser(c, username, d.Configuration.LDAPConfiguration.Attributes)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
+	ldapAttrs := make(map[string]string)
+	for _, v := range d.Configuration.LDAPConfiguration.Attributes {
+		ldapAttrs[v] = ldapUser.GetAttributeValue(v)
+	}
+	if avatarURL := d.avatarURL(username); avatarURL != "" {
+		ldapAttrs["avatar_url"] = avatarURL
+	}
+	_, span = tracing.Start(ctx, "template.execute", attribute.String("template", d.Template.Name()))
+	var resourceFile bytes.Buffer
+	err = d.Template.Execute(&resourceFile, ldapAttrs)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	_, span = tracing.Start(ctx, "yaml.unmarshal")
+	err = yaml.Unmarshal(resourceFile.Bytes(), &resource)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal file to JRD: %w", err)
+	}
 
-	searchString := fmt.Sprintf("(%s=%s)", d.Configuration.LDAPConfiguration.UserAttr, username)
+	resource.Subject = name
+	return &resource, nil
+}
+
+// GetAvatar returns the first non-empty binary avatar attribute of the given
+// user, in the order the attributes are configured.
+func (d ldapDriver) GetAvatar(username string) (*driver.Avatar, error) {
+	avatarAttrs := d.Configuration.LDAPConfiguration.AvatarAttrs
+	if len(avatarAttrs) == 0 {
+		return nil, driver.ResourceNotFound{ResourceName: username}
+	}
+
+	c, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ldapUser, err := d.findUser(c, username, avatarAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attr := range avatarAttrs {
+		data := ldapUser.GetRawAttributeValue(attr)
+		if len(data) != 0 {
+			return &driver.Avatar{
+				Data:        data,
+				ContentType: http.DetectContentType(data),
+			}, nil
+		}
+	}
+
+	return nil, driver.ResourceNotFound{ResourceName: username}
+}
+
+// CountUsers returns the number of entries below the base DN that have the
+// user attribute and match the configured filter. The entries are fetched in
+// pages without any of their attributes, as directories commonly limit how
+// many entries a single search may return.
+func (d ldapDriver) CountUsers() (int, error) {
+	ldapConf := d.Configuration.LDAPConfiguration
+
+	searchString := fmt.Sprintf("(%s=*)", ldapConf.UserAttr)
+	if ldapConf.Filter != "" {
+		searchString = fmt.Sprintf("(&%v%v)", ldapConf.Filter, searchString)
+	}
+
+	c, err := d.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	pageSize := ldapConf.PageSize
+	if pageSize == 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+
+	// `1.1` requests no attributes at all, per RFC 4511
+	entries, err := d.searchPaged(c, ldapConf.BaseDN, searchString, []string{"1.1"}, 0, pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// resolveAlias returns the `acct:` resource of the entry whose alias attribute
+// matches the given name. Opaque URIs like `mailto:bob@foobar.com` also match
+// attributes holding just `bob@foobar.com`.
+func (d ldapDriver) resolveAlias(ctx context.Context, name string) (string, error) {
+	ldapConf := d.Configuration.LDAPConfiguration
+
+	domain := ldapConf.Domain
+	if domain == "" {
+		if at := strings.LastIndex(name, "@"); at != -1 {
+			domain = name[at+1:]
+		}
+	}
+	if domain == "" {
+		slog.Debug("cannot resolve alias without a domain", "resource_name", name)
+		return "", driver.ResourceNotFound{ResourceName: name}
+	}
+
+	aliasFilter := fmt.Sprintf("(%s=%s)", ldapConf.AliasAttr, client.EscapeFilter(name))
+	if aliasURL, err := url.Parse(name); err == nil && aliasURL.Opaque != "" {
+		aliasFilter = fmt.Sprintf(
+			"(|%s(%s=%s))",
+			aliasFilter,
+			ldapConf.AliasAttr,
+			client.EscapeFilter(aliasURL.Opaque),
+		)
+	}
+	if ldapConf.Filter != "" {
+		aliasFilter = fmt.Sprintf("(&%v%v)", ldapConf.Filter, aliasFilter)
+	}
+
+	_, span := tracing.Start(ctx, "ldap.connect")
+	c, err := d.connect()
+	tracing.End(span, err)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	_, span = tracing.Start(ctx, "ldap.search", attribute.String("ldap.filter", aliasFilter))
+	entries, err := d.search(c, ldapConf.BaseDN, aliasFilter, []string{ldapConf.UserAttr}, 0)
+	tracing.End(span, err)
+	if err != nil {
+		return "", err
+	}
+
+	if len(entries) > 1 {
+		return "", fmt.Errorf("Error resolving alias: Wanted 1 result, got %v\n", len(entries))
+	} else if len(entries) == 0 {
+		return "", driver.ResourceNotFound{ResourceName: name}
+	}
+
+	username := entries[0].GetAttributeValue(ldapConf.UserAttr)
+	if username == "" {
+		return "", driver.ResourceNotFound{ResourceName: name}
+	}
+
+	return fmt.Sprintf("acct:%s@%s", username, domain), nil
+}
+
+// GetOpenPGPKey returns the binary key attribute of the given user. As with
+// resources, the host is not used when searching for the user.
+func (d ldapDriver) GetOpenPGPKey(user string, host string) ([]byte, error) {
+	keyAttr := d.Configuration.LDAPConfiguration.OpenPGPKeyAttr
+	if keyAttr == "" {
+		return nil, driver.ResourceNotFound{ResourceName: user}
+	}
+
+	c, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ldapUser, err := d.findUser(c, user, []string{keyAttr})
+	if err != nil {
+		return nil, err
+	}
+
+	key := ldapUser.GetRawAttributeValue(keyAttr)
+	if len(key) == 0 {
+		return nil, driver.ResourceNotFound{ResourceName: user}
+	}
+
+	return key, nil
+}
+
+// findUser searches for the single entry whose user attribute matches the
+// given username.
+func (d ldapDriver) findUser(c LdapClient, username string, attributes []string) (*client.Entry, error) {
+	searchString := fmt.Sprintf(
+		"(%s=%s)",
+		d.Configuration.LDAPConfiguration.UserAttr,
+		client.EscapeFilter(username),
+	)
 	if d.Configuration.LDAPConfiguration.Filter != "" {
 		searchString = fmt.Sprintf("(&%v%v)", d.Configuration.LDAPConfiguration.Filter, searchString)
 	}
-	result, err := c.Search(client.NewSearchRequest(
+	entries, err := d.search(
+		c,
 		d.Configuration.LDAPConfiguration.BaseDN,
+		searchString,
+		attributes,
+		0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) > 1 {
+		return nil, fmt.Errorf("Error finding user: Wanted 1 result, got %v\n", len(entries))
+	} else if len(entries) == 0 {
+		return nil, driver.ResourceNotFound{ResourceName: username}
+	}
+
+	return entries[0], nil
+}
+
+// avatarURL returns the public URL of the user's avatar, or an empty string if
+// avatars are not configured.
+func (d ldapDriver) avatarURL(username string) string {
+	avatarConf := d.Configuration.AvatarConfiguration
+	if avatarConf == nil || avatarConf.BaseURL == "" || len(d.Configuration.LDAPConfiguration.AvatarAttrs) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(avatarConf.BaseURL, "/") + "/" + url.PathEscape(username)
+}
+
+// CheckHealth checks that any of the LDAP servers can be connected and bound
+// to. As the LDAP client can't be cancelled, it is abandoned once the context
+// is done.
+func (d ldapDriver) CheckHealth(ctx context.Context) error {
+	result := make(chan error, 1)
+	go func() {
+		c, err := d.connect()
+		if err == nil {
+			c.Close()
+		}
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect returns a bound client for the first reachable server in the pool.
+// Servers that cannot be reached are marked as down, so that subsequent
+// lookups try the remaining servers first.
+func (d ldapDriver) connect() (LdapClient, error) {
+	var errs []error
+	for _, serverURL := range d.Servers.candidates() {
+		c, err := d.dial(serverURL)
+		if err == nil {
+			d.Servers.markUp(serverURL)
+			return c, nil
+		}
+
+		if !isNetworkError(err) {
+			return nil, err
+		}
+
+		slog.Warn("unable to reach LDAP server", "url", serverURL, "err", err)
+		d.Servers.markDown(serverURL)
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no LDAP servers configured")
+	}
+
+	return nil, fmt.Errorf("all LDAP servers are unavailable: %w", errors.Join(errs...))
+}
+
+func (d ldapDriver) dial(serverURL string) (LdapClient, error) {
+	c, err := d.ClientFunc(serverURL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Bind(d.Configuration.LDAPConfiguration.BindUser, d.Configuration.LDAPConfiguration.BindPass)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// search runs a subtree search below baseDN, chasing any returned search
+// result references when referral following is enabled.
+func (d ldapDriver) search(
+	c LdapClient,
+	baseDN string,
+	filter string,
+	attributes []string,
+	hops int,
+) ([]*client.Entry, error) {
+	return d.searchPaged(c, baseDN, filter, attributes, hops, 0)
+}
+
+// searchPaged searches like search, fetching the entries in pages of the given
+// size using the paged results control, unless the page size is zero.
+func (d ldapDriver) searchPaged(
+	c LdapClient,
+	baseDN string,
+	filter string,
+	attributes []string,
+	hops int,
+	pageSize uint32,
+) ([]*client.Entry, error) {
+	request := client.NewSearchRequest(
+		baseDN,
 		client.ScopeWholeSubtree,
 		client.NeverDerefAliases,
 		0,
 		0,
 		false,
-		searchString,
-		d.Configuration.LDAPConfiguration.Attributes,
+		filter,
+		attributes,
 		nil,
-	))
+	)
+
+	var result *client.SearchResult
+	var err error
+	if pageSize == 0 {
+		result, err = c.Search(request)
+	} else {
+		result, err = c.SearchWithPaging(request, pageSize)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if len(result.Entries) > 1 {
-		return nil, fmt.Errorf("Error finding user: Wanted 1 result, got %v\n", len(result.Entries))
-	} else if len(result.Entries) == 0 {
-		return nil, driver.ResourceNotFound{ResourceName: username}
+	entries := result.Entries
+	if !d.Configuration.LDAPConfiguration.FollowReferrals {
+		return entries, nil
 	}
-	ldapUser := result.Entries[0]
-	ldapAttrs := make(map[string]string)
-	for _, v := range d.Configuration.LDAPConfiguration.Attributes {
-		ldapAttrs[v] = ldapUser.GetAttributeValue(v)
+
+	maxHops := d.Configuration.LDAPConfiguration.MaxReferralHops
+	if maxHops == 0 {
+		maxHops = DEFAULT_MAX_REFERRAL_HOPS
 	}
-	var resourceFile bytes.Buffer
-	err = d.Template.Execute(&resourceFile, ldapAttrs)
+
+	for _, referral := range result.Referrals {
+		if hops >= maxHops {
+			slog.Warn("LDAP referral hop limit reached, not following", "referral", referral)
+			continue
+		}
+
+		referred, err := d.followReferral(referral, filter, attributes, hops+1, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("could not follow LDAP referral %s: %w", referral, err)
+		}
+		entries = append(entries, referred...)
+	}
+
+	return entries, nil
+}
+
+func (d ldapDriver) followReferral(
+	referral string,
+	filter string,
+	attributes []string,
+	hops int,
+	pageSize uint32,
+) ([]*client.Entry, error) {
+	referralURL, err := url.Parse(referral)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(resourceFile.Bytes(), &resource)
+
+	baseDN := strings.TrimPrefix(referralURL.Path, "/")
+	if baseDN == "" {
+		baseDN = d.Configuration.LDAPConfiguration.BaseDN
+	}
+
+	slog.Debug("following LDAP referral", "referral", referral, "basedn", baseDN)
+
+	c, err := d.dial(fmt.Sprintf("%s://%s", referralURL.Scheme, referralURL.Host))
 	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal file to JRD: %w", err)
+		return nil, err
 	}
+	defer c.Close()
 
-	resource.Subject = name
-	return &resource, nil
+	return d.searchPaged(c, baseDN, filter, attributes, hops, pageSize)
+}
+
+func isNetworkError(err error) bool {
+	var ldapErr *client.Error
+	if errors.As(err, &ldapErr) {
+		return ldapErr.ResultCode == client.ErrorNetwork
+	}
+
+	return true
 }
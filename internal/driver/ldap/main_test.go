@@ -1,6 +1,7 @@
 package ldap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -68,6 +69,10 @@ func (t testLdapConn) Search(req *client.SearchRequest) (_ *client.SearchResult,
 	return &res, nil
 }
 
+func (t testLdapConn) SearchWithPaging(req *client.SearchRequest, _ uint32) (*client.SearchResult, error) {
+	return t.Search(req)
+}
+
 func TestLdapDriverGetResource(t *testing.T) {
 	conf := config.Configuration{
 		Driver: "ldap",
@@ -85,12 +90,13 @@ func TestLdapDriverGetResource(t *testing.T) {
 	}
 	tmpl := template.New("test")
 	d.Template = template.Must(tmpl.Parse(testLdapTempl))
-	d.ClientFunc = func() (LdapClient, error) {
+	d.ClientFunc = func(string) (LdapClient, error) {
 		return testLdapConn{d, "bob", "Bob", "foobar.com"}, nil
 	}
+	d.Servers = newServerPool(conf.LDAPConfiguration)
 
 	t.Run("can get resource from ldap", func(t *testing.T) {
-		got, err := d.GetResource("acct:bob@foobar.com")
+		got, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -113,7 +119,7 @@ func TestLdapDriverGetResource(t *testing.T) {
 	})
 
 	t.Run("missing resource files should throw error", func(t *testing.T) {
-		resource, err := d.GetResource("missingno")
+		resource, err := d.GetResource(context.Background(), "missingno")
 
 		if err == nil {
 			t.Errorf("should have gotten error, instead got resource: %+v", resource)
@@ -124,3 +130,337 @@ func TestLdapDriverGetResource(t *testing.T) {
 		}
 	})
 }
+
+type referringLdapConn struct {
+	testLdapConn
+	referral string
+}
+
+func (t referringLdapConn) Search(req *client.SearchRequest) (*client.SearchResult, error) {
+	if req.BaseDN == t.driver.Configuration.LDAPConfiguration.BaseDN {
+		return &client.SearchResult{Referrals: []string{t.referral}}, nil
+	}
+
+	return t.testLdapConn.Search(req)
+}
+
+func TestLdapDriverFailover(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "ldap",
+		LDAPConfiguration: &config.LDAPConfiguration{
+			URL:        "ldap://primary.example.com",
+			URLs:       []string{"ldap://secondary.example.com"},
+			BindUser:   "cn=root,dc=example,dc=com",
+			BindPass:   "password",
+			BaseDN:     "ou=Users,dc=example,dc=com",
+			UserAttr:   "uid",
+			Attributes: []string{"uid", "mail", "cn"},
+		},
+	}
+	d := ldapDriver{
+		Configuration: conf,
+		Template:      template.Must(template.New("test").Parse(testLdapTempl)),
+		Servers:       newServerPool(conf.LDAPConfiguration),
+	}
+
+	dialed := []string{}
+	d.ClientFunc = func(url string) (LdapClient, error) {
+		dialed = append(dialed, url)
+		if url == "ldap://primary.example.com" {
+			return nil, client.NewError(client.ErrorNetwork, errors.New("connection refused"))
+		}
+		return testLdapConn{d, "bob", "Bob", "foobar.com"}, nil
+	}
+
+	t.Run("falls back to the next server when one is unreachable", func(t *testing.T) {
+		_, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"ldap://primary.example.com", "ldap://secondary.example.com"}
+		if !cmp.Equal(dialed, want) {
+			t.Errorf("got: %v, want: %v", dialed, want)
+		}
+	})
+
+	t.Run("skips servers that recently failed", func(t *testing.T) {
+		dialed = []string{}
+
+		_, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"ldap://secondary.example.com"}
+		if !cmp.Equal(dialed, want) {
+			t.Errorf("got: %v, want: %v", dialed, want)
+		}
+	})
+
+	t.Run("errors when no servers are reachable", func(t *testing.T) {
+		d.ClientFunc = func(url string) (LdapClient, error) {
+			return nil, client.NewError(client.ErrorNetwork, errors.New("connection refused"))
+		}
+
+		_, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
+		if err == nil {
+			t.Fatal("expected error when all servers are unreachable")
+		}
+
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			t.Errorf("error should not be ResourceNotFound: %+v", err)
+		}
+	})
+}
+
+func TestLdapDriverFollowReferrals(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "ldap",
+		LDAPConfiguration: &config.LDAPConfiguration{
+			URL:             "ldap://ldap.example.com",
+			BindUser:        "cn=root,dc=example,dc=com",
+			BindPass:        "password",
+			BaseDN:          "dc=example,dc=com",
+			UserAttr:        "uid",
+			Attributes:      []string{"uid", "mail", "cn"},
+			FollowReferrals: true,
+		},
+	}
+	d := ldapDriver{
+		Configuration: conf,
+		Template:      template.Must(template.New("test").Parse(testLdapTempl)),
+		Servers:       newServerPool(conf.LDAPConfiguration),
+	}
+
+	dialed := []string{}
+	d.ClientFunc = func(url string) (LdapClient, error) {
+		dialed = append(dialed, url)
+		return referringLdapConn{
+			testLdapConn{d, "bob", "Bob", "foobar.com"},
+			"ldap://other.example.com/ou=Other,dc=example,dc=com",
+		}, nil
+	}
+
+	t.Run("follows search result references to other servers", func(t *testing.T) {
+		got, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Subject != "acct:bob@foobar.com" {
+			t.Errorf("unexpected subject: %v", got.Subject)
+		}
+
+		want := []string{"ldap://ldap.example.com", "ldap://other.example.com"}
+		if !cmp.Equal(dialed, want) {
+			t.Errorf("got: %v, want: %v", dialed, want)
+		}
+	})
+}
+
+type avatarLdapConn struct {
+	testLdapConn
+	photo []byte
+}
+
+func (t avatarLdapConn) Search(req *client.SearchRequest) (*client.SearchResult, error) {
+	res, err := t.testLdapConn.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Entries[0].Attributes = append(res.Entries[0].Attributes, &client.EntryAttribute{
+		Name:       "jpegPhoto",
+		Values:     []string{string(t.photo)},
+		ByteValues: [][]byte{t.photo},
+	})
+
+	return res, nil
+}
+
+func TestLdapDriverGetAvatar(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "ldap",
+		LDAPConfiguration: &config.LDAPConfiguration{
+			URL:         "ldaps://ldap.example.com",
+			BaseDN:      "ou=Users,dc=example,dc=com",
+			UserAttr:    "uid",
+			Attributes:  []string{"uid", "mail", "cn"},
+			AvatarAttrs: []string{"thumbnailPhoto", "jpegPhoto"},
+		},
+		AvatarConfiguration: &config.AvatarConfiguration{
+			BaseURL: "https://foobar.com/avatar/",
+		},
+	}
+	d := ldapDriver{
+		Configuration: conf,
+		Template: template.Must(template.New("test").Parse(
+			`links: [{rel: "http://webfinger.net/rel/avatar", href: '{{ index . "avatar_url" }}'}]`,
+		)),
+		Servers: newServerPool(conf.LDAPConfiguration),
+	}
+
+	photo := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	d.ClientFunc = func(string) (LdapClient, error) {
+		return avatarLdapConn{testLdapConn{d, "bob", "Bob", "foobar.com"}, photo}, nil
+	}
+
+	t.Run("can get avatar from binary attribute", func(t *testing.T) {
+		got, err := d.GetAvatar("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := &driver.Avatar{Data: photo, ContentType: "image/jpeg"}
+		if !cmp.Equal(got, want) {
+			t.Errorf("\n got: %+v \n want: %+v", got, want)
+		}
+	})
+
+	t.Run("searching for unknown users errors", func(t *testing.T) {
+		_, err := d.GetAvatar("alice")
+
+		var ldapErr *client.Error
+		if !errors.As(err, &ldapErr) {
+			t.Errorf("expected LDAP error for unknown user, got: %+v", err)
+		}
+	})
+
+	t.Run("avatar url is available to templates", func(t *testing.T) {
+		got, err := d.GetResource(context.Background(), "acct:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.Links) != 1 || *got.Links[0].Href != "https://foobar.com/avatar/bob" {
+			t.Errorf("unexpected links: %+v", got.Links)
+		}
+	})
+}
+
+type aliasLdapConn struct {
+	testLdapConn
+}
+
+func (t aliasLdapConn) Search(req *client.SearchRequest) (*client.SearchResult, error) {
+	if req.Filter == "(|(mail=mailto:bob@foobar.com)(mail=bob@foobar.com))" {
+		return &client.SearchResult{
+			Entries: []*client.Entry{
+				client.NewEntry("uid=bob,ou=Users,dc=example,dc=com", map[string][]string{"uid": {"bob"}}),
+			},
+		}, nil
+	}
+
+	if req.Filter == "(mail=https://mastodon/alice)" {
+		return &client.SearchResult{}, nil
+	}
+
+	return t.testLdapConn.Search(req)
+}
+
+func TestLdapDriverGetResourceByAlias(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "ldap",
+		LDAPConfiguration: &config.LDAPConfiguration{
+			URL:        "ldaps://ldap.example.com",
+			BaseDN:     "ou=Users,dc=example,dc=com",
+			UserAttr:   "uid",
+			Attributes: []string{"uid", "mail", "cn"},
+			AliasAttr:  "mail",
+			Domain:     "example.com",
+		},
+	}
+	d := ldapDriver{
+		Configuration: conf,
+		Template:      template.Must(template.New("test").Parse(testLdapTempl)),
+		Servers:       newServerPool(conf.LDAPConfiguration),
+	}
+	d.ClientFunc = func(string) (LdapClient, error) {
+		return aliasLdapConn{testLdapConn{d, "bob", "Bob", "foobar.com"}}, nil
+	}
+
+	t.Run("resolves aliases to the canonical subject", func(t *testing.T) {
+		got, err := d.GetResource(context.Background(), "mailto:bob@foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Subject != "acct:bob@example.com" {
+			t.Errorf("expected canonical subject, got: %v", got.Subject)
+		}
+	})
+
+	t.Run("unknown aliases are not found", func(t *testing.T) {
+		_, err := d.GetResource(context.Background(), "https://mastodon/alice")
+		if !errors.As(err, &driver.ResourceNotFound{}) {
+			t.Errorf("error should be ResourceNotFound: %+v", err)
+		}
+	})
+}
+
+// sizeLimitedLdapConn holds many users, and refuses searches returning more
+// entries than its size limit, unless they are paged.
+type sizeLimitedLdapConn struct {
+	testLdapConn
+	users     int
+	sizeLimit int
+	pageSizes *[]uint32
+}
+
+func (t sizeLimitedLdapConn) Search(req *client.SearchRequest) (*client.SearchResult, error) {
+	if t.users > t.sizeLimit {
+		return nil, &ldap.Error{ResultCode: ldap.LDAPResultSizeLimitExceeded}
+	}
+
+	return t.SearchWithPaging(req, uint32(t.users))
+}
+
+func (t sizeLimitedLdapConn) SearchWithPaging(req *client.SearchRequest, pageSize uint32) (*client.SearchResult, error) {
+	*t.pageSizes = append(*t.pageSizes, pageSize)
+	if int(pageSize) > t.sizeLimit {
+		return nil, &ldap.Error{ResultCode: ldap.LDAPResultSizeLimitExceeded}
+	}
+
+	var res client.SearchResult
+	for i := range t.users {
+		res.Entries = append(res.Entries, &ldap.Entry{DN: fmt.Sprintf("uid=user%d,%v", i, req.BaseDN)})
+	}
+
+	return &res, nil
+}
+
+func TestLdapDriverCountUsers(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "ldap",
+		LDAPConfiguration: &config.LDAPConfiguration{
+			URL:      "ldaps://ldap.example.com",
+			BaseDN:   "ou=Users,dc=example,dc=com",
+			UserAttr: "uid",
+		},
+	}
+	d := ldapDriver{
+		Configuration: conf,
+		Servers:       newServerPool(conf.LDAPConfiguration),
+	}
+
+	var pageSizes []uint32
+	d.ClientFunc = func(string) (LdapClient, error) {
+		return sizeLimitedLdapConn{testLdapConn{d, "bob", "Bob", "foobar.com"}, 1200, 1000, &pageSizes}, nil
+	}
+
+	t.Run("counts more users than the server's size limit", func(t *testing.T) {
+		count, err := d.CountUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 1200 {
+			t.Errorf("got %v users, want 1200", count)
+		}
+
+		if !cmp.Equal(pageSizes, []uint32{DEFAULT_PAGE_SIZE}) {
+			t.Errorf("got page sizes %v, want a single paged search", pageSizes)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package ldap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/metrics"
+)
+
+const DEFAULT_SERVER_COOLDOWN = 30 * time.Second
+
+// serverPool keeps track of which LDAP servers have recently failed, and
+// decides the order in which servers are tried for each lookup.
+type serverPool struct {
+	mu         sync.Mutex
+	urls       []string
+	roundRobin bool
+	cooldown   time.Duration
+	next       int
+	downUntil  map[string]time.Time
+	now        func() time.Time
+}
+
+func newServerPool(conf *config.LDAPConfiguration) *serverPool {
+	urls := []string{}
+	if conf.URL != "" {
+		urls = append(urls, conf.URL)
+	}
+	urls = append(urls, conf.URLs...)
+
+	cooldown := conf.ServerCooldown
+	if cooldown == 0 {
+		cooldown = DEFAULT_SERVER_COOLDOWN
+	}
+
+	for _, url := range urls {
+		metrics.SetLDAPServerUp(url, true)
+	}
+
+	return &serverPool{
+		urls:       urls,
+		roundRobin: conf.Failover == config.LDAPFailoverRoundRobin,
+		cooldown:   cooldown,
+		downUntil:  make(map[string]time.Time),
+		now:        time.Now,
+	}
+}
+
+// candidates returns every server in the order it should be tried. Servers
+// that failed within the cooldown period are moved to the back of the list, so
+// that they are still attempted as a last resort.
+func (p *serverPool) candidates() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.urls) == 0 {
+		return nil
+	}
+
+	start := 0
+	if p.roundRobin {
+		start = p.next % len(p.urls)
+		p.next = (p.next + 1) % len(p.urls)
+	}
+
+	now := p.now()
+	healthy := make([]string, 0, len(p.urls))
+	unhealthy := []string{}
+	for i := range p.urls {
+		url := p.urls[(start+i)%len(p.urls)]
+		if now.Before(p.downUntil[url]) {
+			unhealthy = append(unhealthy, url)
+		} else {
+			healthy = append(healthy, url)
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+func (p *serverPool) markDown(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.downUntil[url] = p.now().Add(p.cooldown)
+	metrics.SetLDAPServerUp(url, false)
+}
+
+func (p *serverPool) markUp(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.downUntil, url)
+	metrics.SetLDAPServerUp(url, true)
+}
@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestServerPoolCandidates(t *testing.T) {
+	t.Run("ordered pool always starts with the first server", func(t *testing.T) {
+		pool := newServerPool(&config.LDAPConfiguration{
+			URL:  "ldap://a",
+			URLs: []string{"ldap://b", "ldap://c"},
+		})
+
+		for i := 0; i < 2; i++ {
+			got := pool.candidates()
+			want := []string{"ldap://a", "ldap://b", "ldap://c"}
+			if !cmp.Equal(got, want) {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		}
+	})
+
+	t.Run("round robin pool rotates the starting server", func(t *testing.T) {
+		pool := newServerPool(&config.LDAPConfiguration{
+			URLs:     []string{"ldap://a", "ldap://b", "ldap://c"},
+			Failover: config.LDAPFailoverRoundRobin,
+		})
+
+		pool.candidates()
+		got := pool.candidates()
+		want := []string{"ldap://b", "ldap://c", "ldap://a"}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	})
+
+	t.Run("failed servers are tried last until their cooldown expires", func(t *testing.T) {
+		now := time.Now()
+		pool := newServerPool(&config.LDAPConfiguration{
+			URLs:           []string{"ldap://a", "ldap://b"},
+			ServerCooldown: time.Minute,
+		})
+		pool.now = func() time.Time { return now }
+
+		pool.markDown("ldap://a")
+
+		got := pool.candidates()
+		want := []string{"ldap://b", "ldap://a"}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+
+		now = now.Add(2 * time.Minute)
+
+		got = pool.candidates()
+		want = []string{"ldap://a", "ldap://b"}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	})
+}
@@ -1,13 +1,53 @@
 package driver
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/peeley/carpal/internal/resource"
 )
 
 type Driver interface {
-	GetResource(string) (*resource.Resource, error)
+	GetResource(ctx context.Context, name string) (*resource.Resource, error)
+	// Name returns the name the driver is configured by, e.g. `file`.
+	Name() string
+}
+
+// Avatar is a user's profile image, as served by the avatar endpoint.
+type Avatar struct {
+	Data        []byte
+	ContentType string
+}
+
+// AvatarDriver is implemented by drivers that can fetch a user's avatar
+// image, e.g. from a binary LDAP attribute.
+type AvatarDriver interface {
+	GetAvatar(string) (*Avatar, error)
+}
+
+// UserCounter is implemented by drivers that can count the users they serve,
+// e.g. for the NodeInfo usage statistics.
+type UserCounter interface {
+	CountUsers() (int, error)
+}
+
+// OpenPGPKeyDriver is implemented by drivers that can fetch the binary OpenPGP
+// public key of an address, e.g. for the Web Key Directory.
+type OpenPGPKeyDriver interface {
+	GetOpenPGPKey(user string, host string) ([]byte, error)
+}
+
+// OpenPGPKeyHashDriver is implemented by drivers that can find the OpenPGP key
+// of an address by the WKD hash of its local part alone, for clients that
+// don't send the local part along.
+type OpenPGPKeyHashDriver interface {
+	GetOpenPGPKeyByHash(hash string, host string) ([]byte, error)
+}
+
+// HealthChecker is implemented by drivers that can check whether their backend
+// is reachable, e.g. for readiness probes.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
 }
 
 type ResourceNotFound struct {
@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/resource"
+)
+
+type resourcePattern struct {
+	match    *regexp.Regexp
+	resource string
+}
+
+// ResourceRewriter maps requested resources matching configured patterns, like
+// `https://foobar.com/~bob`, onto the resource a driver can look up, like
+// `acct:bob@foobar.com`.
+type ResourceRewriter struct {
+	patterns []resourcePattern
+}
+
+// NewResourceRewriter compiles the given patterns, which are expected to have
+// already been validated when loading the configuration.
+func NewResourceRewriter(patterns []config.ResourcePattern) ResourceRewriter {
+	rewriter := ResourceRewriter{}
+	for _, pattern := range patterns {
+		rewriter.patterns = append(rewriter.patterns, resourcePattern{
+			match:    regexp.MustCompile(pattern.Match),
+			resource: pattern.Resource,
+		})
+	}
+
+	return rewriter
+}
+
+// Rewrite returns the resource for the first pattern matching name, expanding
+// any `$1` or `${name}` submatch references.
+func (r ResourceRewriter) Rewrite(name string) (string, bool) {
+	for _, pattern := range r.patterns {
+		submatches := pattern.match.FindStringSubmatchIndex(name)
+		if submatches == nil {
+			continue
+		}
+
+		return string(pattern.match.ExpandString(nil, pattern.resource, name, submatches)), true
+	}
+
+	return "", false
+}
+
+// Resolve looks up name using lookup, rewriting it first if it matches one of
+// the patterns. The requested name is then listed among the resource's aliases.
+func (r ResourceRewriter) Resolve(
+	name string,
+	lookup func(string) (*resource.Resource, error),
+) (*resource.Resource, error) {
+	rewritten, ok := r.Rewrite(name)
+	if !ok {
+		return lookup(name)
+	}
+
+	res, err := lookup(rewritten)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Subject != name && !slices.Contains(res.Aliases, name) {
+		res.Aliases = append(res.Aliases, name)
+	}
+
+	return res, nil
+}
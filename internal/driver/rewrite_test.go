@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/resource"
+)
+
+func TestResourceRewriter(t *testing.T) {
+	rewriter := NewResourceRewriter([]config.ResourcePattern{
+		{
+			Match:    `^https://(?P<host>foobar\.com)/~(?P<user>[^/]+)/?$`,
+			Resource: "acct:${user}@${host}",
+		},
+		{
+			Match:    `^mailto:([^@]+)@foobar\.com$`,
+			Resource: "acct:$1@foobar.com",
+		},
+	})
+
+	t.Run("rewrites resources matching a pattern", func(t *testing.T) {
+		cases := map[string]string{
+			"https://foobar.com/~bob/": "acct:bob@foobar.com",
+			"mailto:alice@foobar.com":  "acct:alice@foobar.com",
+		}
+
+		for name, want := range cases {
+			got, ok := rewriter.Rewrite(name)
+			if !ok || got != want {
+				t.Errorf("got: %v, %v, want: %v", got, ok, want)
+			}
+		}
+	})
+
+	t.Run("leaves other resources alone", func(t *testing.T) {
+		got, ok := rewriter.Rewrite("https://example.com/~bob")
+		if ok {
+			t.Errorf("expected no rewrite, got: %v", got)
+		}
+	})
+
+	t.Run("lists the requested resource as an alias", func(t *testing.T) {
+		lookup := func(name string) (*resource.Resource, error) {
+			if name != "acct:bob@foobar.com" {
+				return nil, ResourceNotFound{ResourceName: name}
+			}
+			return &resource.Resource{Subject: name, Aliases: []string{"mailto:bob@foobar.com"}}, nil
+		}
+
+		got, err := rewriter.Resolve("https://foobar.com/~bob", lookup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := &resource.Resource{
+			Subject: "acct:bob@foobar.com",
+			Aliases: []string{"mailto:bob@foobar.com", "https://foobar.com/~bob"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+	})
+}
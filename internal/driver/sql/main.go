@@ -2,19 +2,25 @@ package sql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 	"text/template"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/peeley/carpal/internal/config"
 	"github.com/peeley/carpal/internal/driver"
+	"github.com/peeley/carpal/internal/metrics"
 	"github.com/peeley/carpal/internal/resource"
+	"github.com/peeley/carpal/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,10 +29,26 @@ type SQLClient interface {
 	Close() error
 }
 
+const (
+	DEFAULT_CONNECT_TIMEOUT = 30 * time.Second
+	INITIAL_CONNECT_BACKOFF = 500 * time.Millisecond
+	MAX_CONNECT_BACKOFF     = 10 * time.Second
+)
+
 type sqlDriver struct {
 	Configuration config.Configuration
 	Template      *template.Template
 	DB            *sql.DB
+	Query         namedQuery
+	LinksQuery    namedQuery
+	AliasQuery    namedQuery
+	CountQuery    namedQuery
+	KeyQuery      namedQuery
+	Rewriter      driver.ResourceRewriter
+
+	// ColumnNames are the keys of the resource query's columns in template
+	// data. They are nil for custom queries, whose result set names are used.
+	ColumnNames []string
 }
 
 func NewSQLDriver(conf config.Configuration) (driver.Driver, error) {
@@ -37,15 +59,265 @@ func NewSQLDriver(conf config.Configuration) (driver.Driver, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	configurePool(db, conf.DatabaseConfiguration)
+
+	connectTimeout := conf.DatabaseConfiguration.ConnectTimeout
+	if connectTimeout == 0 {
+		connectTimeout = DEFAULT_CONNECT_TIMEOUT
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+
+	if err := pingDatabase(ctx, db, INITIAL_CONNECT_BACKOFF); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database unreachable after %s: %w", connectTimeout, err)
+	}
+
+	sqlDriver, err := newSQLDriver(conf, tmpl, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	metrics.RegisterDatabase(db, conf.DatabaseConfiguration.Driver)
+
+	return sqlDriver, nil
+}
+
+func configurePool(db *sql.DB, conf *config.DatabaseConfiguration) {
+	if conf.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(conf.MaxOpenConns)
+	}
+	if conf.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(conf.MaxIdleConns)
+	}
+	if conf.ConnMaxLifetime != 0 {
+		db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	}
+	if conf.ConnMaxIdleTime != 0 {
+		db.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	}
+}
+
+// pingDatabase pings the database until it responds, backing off
+// exponentially between attempts, until the context expires.
+func pingDatabase(ctx context.Context, db *sql.DB, backoff time.Duration) error {
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		slog.Warn("unable to reach database, retrying", "err", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, MAX_CONNECT_BACKOFF)
+	}
+}
+
+func newSQLDriver(conf config.Configuration, tmpl *template.Template, db *sql.DB) (*sqlDriver, error) {
+	dbConf := conf.DatabaseConfiguration
+
+	hasQuery := dbConf.Query != ""
+	hasTable := dbConf.Table != "" || dbConf.KeyColumn != "" || len(dbConf.ColumnNames) != 0
+
+	if hasQuery == hasTable {
+		return nil, errors.New("must specify either query or table, key_column and column_names")
+	}
+
+	query := dbConf.Query
+	var columnNames []string
+	if hasTable {
+		columnNames = dbConf.ColumnNames
+		query = fmt.Sprintf("SELECT %s FROM %s WHERE %s = :acct",
+			strings.Join(dbConf.ColumnNames, ","),
+			dbConf.Table,
+			dbConf.KeyColumn,
+		)
+	}
+
+	compiled, err := compileNamedQuery(query, dbConf.Driver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database query: %w", err)
+	}
+
+	var linksQuery namedQuery
+	if dbConf.LinksQuery != "" {
+		linksQuery, err = compileNamedQuery(dbConf.LinksQuery, dbConf.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database links query: %w", err)
+		}
+	}
+
+	aliasQuery := dbConf.AliasQuery
+	if dbConf.AliasColumn != "" {
+		if aliasQuery != "" || !hasTable {
+			return nil, errors.New("alias_column requires table and key_column, use alias_query with custom queries")
+		}
+
+		aliasQuery = fmt.Sprintf("SELECT %s FROM %s WHERE %s = :resource",
+			dbConf.KeyColumn,
+			dbConf.Table,
+			dbConf.AliasColumn,
+		)
+	}
+
+	var compiledAliasQuery namedQuery
+	if aliasQuery != "" {
+		compiledAliasQuery, err = compileNamedQuery(aliasQuery, dbConf.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database alias query: %w", err)
+		}
+	}
+
+	countQuery := dbConf.CountQuery
+	if countQuery == "" && hasTable {
+		countQuery = fmt.Sprintf("SELECT COUNT(*) FROM %s", dbConf.Table)
+	}
+
+	var compiledCountQuery namedQuery
+	if countQuery != "" {
+		compiledCountQuery, err = compileNamedQuery(countQuery, dbConf.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database count query: %w", err)
+		}
+	}
+
+	keyQuery := dbConf.OpenPGPKeyQuery
+	if dbConf.OpenPGPKeyColumn != "" {
+		if keyQuery != "" || !hasTable {
+			return nil, errors.New("openpgp_key_column requires table and key_column, use openpgp_key_query with custom queries")
+		}
+
+		keyQuery = fmt.Sprintf("SELECT %s FROM %s WHERE %s = :acct",
+			dbConf.OpenPGPKeyColumn,
+			dbConf.Table,
+			dbConf.KeyColumn,
+		)
+	}
+
+	var compiledKeyQuery namedQuery
+	if keyQuery != "" {
+		compiledKeyQuery, err = compileNamedQuery(keyQuery, dbConf.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("invalid database OpenPGP key query: %w", err)
+		}
+	}
+
 	return &sqlDriver{
 		Configuration: conf,
 		Template:      tmpl,
 		DB:            db,
+		Query:         compiled,
+		LinksQuery:    linksQuery,
+		AliasQuery:    compiledAliasQuery,
+		CountQuery:    compiledCountQuery,
+		KeyQuery:      compiledKeyQuery,
+		Rewriter:      driver.NewResourceRewriter(dbConf.ResourcePatterns),
+		ColumnNames:   columnNames,
 	}, nil
 }
 
-func (d *sqlDriver) GetResource(name string) (*resource.Resource, error) {
-	re, err := regexp.Compile("acct:(.+@.+)")
+func (d *sqlDriver) GetResource(ctx context.Context, name string) (*resource.Resource, error) {
+	return d.Rewriter.Resolve(name, func(name string) (*resource.Resource, error) {
+		return d.lookup(ctx, name)
+	})
+}
+
+func (d *sqlDriver) Name() string {
+	return "sql"
+}
+
+func (d *sqlDriver) lookup(ctx context.Context, name string) (*resource.Resource, error) {
+	res, err := d.getResource(ctx, name)
+	if err == nil || d.AliasQuery.SQL == "" || !errors.As(err, &driver.ResourceNotFound{}) {
+		return res, err
+	}
+
+	account, err := d.resolveAlias(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.getResource(ctx, account)
+}
+
+// CountUsers runs the count query, which must return a single number.
+func (d *sqlDriver) CountUsers() (int, error) {
+	if d.CountQuery.SQL == "" {
+		return 0, errors.New("counting users requires either table or count_query")
+	}
+
+	var count int
+	if err := d.DB.QueryRow(d.CountQuery.SQL, d.CountQuery.Args(nil)...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetOpenPGPKey runs the key query, which must return a single binary column.
+func (d *sqlDriver) GetOpenPGPKey(user string, host string) ([]byte, error) {
+	address := user + "@" + host
+	if d.KeyQuery.SQL == "" {
+		return nil, driver.ResourceNotFound{ResourceName: address}
+	}
+
+	params := map[string]string{
+		"user":     user,
+		"host":     host,
+		"acct":     address,
+		"resource": "acct:" + address,
+	}
+
+	var key []byte
+	if err := d.DB.QueryRow(d.KeyQuery.SQL, d.KeyQuery.Args(params)...).Scan(&key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, driver.ResourceNotFound{ResourceName: address}
+		}
+		return nil, fmt.Errorf("failed to query OpenPGP key: %w", err)
+	}
+
+	if len(key) == 0 {
+		return nil, driver.ResourceNotFound{ResourceName: address}
+	}
+
+	return key, nil
+}
+
+// resolveAlias returns the `acct:` resource that lists the given name as one
+// of its aliases.
+func (d *sqlDriver) resolveAlias(ctx context.Context, name string) (string, error) {
+	ctx, span := tracing.Start(ctx, "sql.query", attribute.String("db.query.text", d.AliasQuery.SQL))
+	var account sql.NullString
+	err := d.DB.QueryRowContext(ctx, d.AliasQuery.SQL, d.AliasQuery.Args(map[string]string{"resource": name})...).Scan(&account)
+	tracing.End(span, err)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", driver.ResourceNotFound{ResourceName: name}
+		}
+		return "", fmt.Errorf("failed to resolve alias: %w", err)
+	}
+
+	if !account.Valid || account.String == "" {
+		return "", driver.ResourceNotFound{ResourceName: name}
+	}
+
+	if strings.HasPrefix(account.String, "acct:") {
+		return account.String, nil
+	}
+
+	return "acct:" + account.String, nil
+}
+
+func (d *sqlDriver) getResource(ctx context.Context, name string) (*resource.Resource, error) {
+	re, err := regexp.Compile("acct:((.+)@(.+))")
 	if err != nil {
 		return nil, err
 	}
@@ -55,33 +327,130 @@ func (d *sqlDriver) GetResource(name string) (*resource.Resource, error) {
 	}
 	email := resourceName[1]
 
-	column_names := strings.Join(d.Configuration.DatabaseConfiguration.ColumnNames, ",")
-	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1",
-		column_names,
-		d.Configuration.DatabaseConfiguration.Table,
-		d.Configuration.DatabaseConfiguration.KeyColumn,
-	)
+	params := map[string]string{
+		"user":     resourceName[2],
+		"host":     resourceName[3],
+		"acct":     email,
+		"resource": name,
+	}
 
-	row := d.DB.QueryRow(query, email)
+	row, err := d.queryResource(ctx, params)
+	if err != nil {
+		return nil, err
+	}
 	if row == nil {
 		return nil, driver.ResourceNotFound{ResourceName: email}
 	}
 
-	columns := make([]sql.NullString, len(d.Configuration.DatabaseConfiguration.ColumnNames))
+	data := make(map[string]any)
+	for colName, value := range row {
+		data[colName] = value
+	}
+
+	if d.LinksQuery.SQL != "" {
+		links, err := d.queryLinks(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		data["links"] = links
+	}
+
+	_, span := tracing.Start(ctx, "template.execute", attribute.String("template", d.Template.Name()))
+	var resourceFile bytes.Buffer
+	err = d.Template.Execute(&resourceFile, data)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	_, span = tracing.Start(ctx, "yaml.unmarshal")
+	var res resource.Resource
+	err = yaml.Unmarshal(resourceFile.Bytes(), &res)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal YAML to resource: %w", err)
+	}
+
+	res.Subject = name
+	return &res, nil
+}
+
+// queryResource runs the resource query, returning the first row, or nil if
+// there is none.
+func (d *sqlDriver) queryResource(ctx context.Context, params map[string]string) (row map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "sql.query", attribute.String("db.query.text", d.Query.SQL))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := d.DB.QueryContext(ctx, d.Query.SQL, d.Query.Args(params)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read rows: %w", err)
+		}
+		return nil, nil
+	}
+
+	return scanRow(rows, d.ColumnNames)
+}
+
+// queryLinks runs the links query, returning every row so that templates can
+// range over them.
+func (d *sqlDriver) queryLinks(ctx context.Context, params map[string]string) (links []map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "sql.query", attribute.String("db.query.text", d.LinksQuery.SQL))
+	defer func() { tracing.End(span, err) }()
+
+	rows, err := d.DB.QueryContext(ctx, d.LinksQuery.SQL, d.LinksQuery.Args(params)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query links: %w", err)
+	}
+	defer rows.Close()
+
+	links = []map[string]string{}
+	for rows.Next() {
+		link, err := scanRow(rows, nil)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read link rows: %w", err)
+	}
+
+	return links, nil
+}
+
+// scanRow reads the current row into a map keyed by the given column names or,
+// if there are none, by the column names of the result set. The configured
+// names are kept as written, as databases may report them differently, e.g.
+// Postgres folds unquoted names to lower case. NULL values are rendered as
+// empty strings.
+func scanRow(rows *sql.Rows, columnNames []string) (map[string]string, error) {
+	if columnNames == nil {
+		var err error
+		columnNames, err = rows.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns: %w", err)
+		}
+	}
+
+	columns := make([]sql.NullString, len(columnNames))
 	columnPointers := make([]interface{}, len(columns))
 	for i := range columns {
 		columnPointers[i] = &columns[i]
 	}
 
-	if err := row.Scan(columnPointers...); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, driver.ResourceNotFound{ResourceName: email}
-		}
+	if err := rows.Scan(columnPointers...); err != nil {
 		return nil, fmt.Errorf("failed to scan row: %w", err)
 	}
 
 	data := make(map[string]string)
-	for i, colName := range d.Configuration.DatabaseConfiguration.ColumnNames {
+	for i, colName := range columnNames {
 		if columns[i].Valid {
 			data[colName] = columns[i].String
 		} else {
@@ -89,16 +458,15 @@ func (d *sqlDriver) GetResource(name string) (*resource.Resource, error) {
 		}
 	}
 
-	var resourceFile bytes.Buffer
-	if err := d.Template.Execute(&resourceFile, data); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
-	}
+	return data, nil
+}
 
-	var res resource.Resource
-	if err := yaml.Unmarshal(resourceFile.Bytes(), &res); err != nil {
-		return nil, fmt.Errorf("could not unmarshal YAML to resource: %w", err)
-	}
+// CheckHealth pings the database.
+func (d *sqlDriver) CheckHealth(ctx context.Context) error {
+	return d.DB.PingContext(ctx)
+}
 
-	res.Subject = name
-	return &res, nil
+// Close closes the connection pool, once in-flight requests have finished.
+func (d *sqlDriver) Close() error {
+	return d.DB.Close()
 }
@@ -0,0 +1,99 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryParams are the named parameters available to configured queries.
+var queryParams = map[string]bool{
+	"user":     true, // local part of the account, e.g. `bob`
+	"host":     true, // host of the account, e.g. `foobar.com`
+	"acct":     true, // the full account, e.g. `bob@foobar.com`
+	"resource": true, // the requested resource, e.g. `acct:bob@foobar.com`
+}
+
+// namedQuery is a SQL query whose `:name` parameters have been rewritten into
+// the positional placeholders understood by a specific database driver.
+type namedQuery struct {
+	SQL    string
+	Params []string
+}
+
+func compileNamedQuery(query string, driverName string) (namedQuery, error) {
+	var compiled strings.Builder
+	params := []string{}
+	positions := make(map[string]int)
+
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		if c == '\'' {
+			inString = !inString
+		}
+
+		if inString || c != ':' {
+			compiled.WriteByte(c)
+			continue
+		}
+
+		// postgres type casts, e.g. `id::text`
+		if i+1 < len(query) && query[i+1] == ':' {
+			compiled.WriteString("::")
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(query) && isParamChar(query[end], end == i+1) {
+			end++
+		}
+
+		name := query[i+1 : end]
+		if name == "" {
+			compiled.WriteByte(c)
+			continue
+		}
+
+		if !queryParams[name] {
+			return namedQuery{}, fmt.Errorf("unknown query parameter `:%s`", name)
+		}
+
+		if driverName == "postgres" {
+			position, ok := positions[name]
+			if !ok {
+				params = append(params, name)
+				position = len(params)
+				positions[name] = position
+			}
+			fmt.Fprintf(&compiled, "$%d", position)
+		} else {
+			params = append(params, name)
+			compiled.WriteByte('?')
+		}
+
+		i = end - 1
+	}
+
+	return namedQuery{SQL: compiled.String(), Params: params}, nil
+}
+
+func isParamChar(c byte, first bool) bool {
+	isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	if first {
+		return isLetter
+	}
+
+	return isLetter || (c >= '0' && c <= '9')
+}
+
+// Args returns the positional arguments of the query, in placeholder order.
+func (q namedQuery) Args(values map[string]string) []any {
+	args := make([]any, len(q.Params))
+	for i, param := range q.Params {
+		args[i] = values[param]
+	}
+
+	return args
+}
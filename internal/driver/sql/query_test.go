@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompileNamedQuery(t *testing.T) {
+	t.Run("rewrites named parameters into numbered placeholders for postgres", func(t *testing.T) {
+		got, err := compileNamedQuery(
+			"SELECT id::text FROM users WHERE handle = :user AND domain = :host OR email = :user || '@' || :host",
+			"postgres",
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := namedQuery{
+			SQL:    "SELECT id::text FROM users WHERE handle = $1 AND domain = $2 OR email = $1 || '@' || $2",
+			Params: []string{"user", "host"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+	})
+
+	t.Run("rewrites named parameters into question marks for other drivers", func(t *testing.T) {
+		got, err := compileNamedQuery("SELECT * FROM users WHERE handle = :user AND domain = :host AND handle != :user", "mysql")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := namedQuery{
+			SQL:    "SELECT * FROM users WHERE handle = ? AND domain = ? AND handle != ?",
+			Params: []string{"user", "host", "user"},
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got: %+v, want: %+v", got, want)
+		}
+
+		args := got.Args(map[string]string{"user": "bob", "host": "foobar.com"})
+		if !cmp.Equal(args, []any{"bob", "foobar.com", "bob"}) {
+			t.Errorf("unexpected args: %v", args)
+		}
+	})
+
+	t.Run("ignores colons inside string literals", func(t *testing.T) {
+		got, err := compileNamedQuery("SELECT 'acct:' || handle FROM users WHERE handle = :user", "sqlite3")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.SQL != "SELECT 'acct:' || handle FROM users WHERE handle = ?" {
+			t.Errorf("unexpected query: %v", got.SQL)
+		}
+	})
+
+	t.Run("errors on unknown parameters", func(t *testing.T) {
+		_, err := compileNamedQuery("SELECT * FROM users WHERE handle = :username", "postgres")
+		if err == nil {
+			t.Fatal("expected error on unknown parameter")
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/peeley/carpal/internal/driver"
+	"github.com/peeley/carpal/internal/resource"
+	"github.com/peeley/carpal/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// lookupAccount fetches the `acct:` resource of the given user from the
+// driver, for the well-known endpoints that identify users by name alone.
+func lookupAccount(ctx context.Context, d driver.Driver, user string, host string) (*resource.Resource, error) {
+	return getResource(ctx, d, "acct:"+user+"@"+host)
+}
+
+// getResource fetches the resource from the driver within a span, which the
+// spans of every lookup attempt the driver makes, e.g. through aliases or
+// resource patterns, are children of.
+func getResource(ctx context.Context, d driver.Driver, name string) (res *resource.Resource, err error) {
+	ctx, span := tracing.Start(ctx, "driver.get_resource",
+		attribute.String("driver", d.Name()),
+		attribute.String("resource", name),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	return d.GetResource(ctx, name)
+}
+
+// requestHost returns the host the request was made to, without any port.
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+
+	return strings.ToLower(host)
+}
+
+// propertyString returns the value of a resource property, if it is a string.
+func propertyString(res *resource.Resource, property string) (string, bool) {
+	value, ok := res.Properties[property].(string)
+	return value, ok
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGetResourceTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test",
+		},
+	}
+
+	t.Run("groups the driver's spans under a lookup span", func(t *testing.T) {
+		_, err := lookupAccount(context.Background(), file.NewFileDriver(conf), "bob", "foobar.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		spans := recorder.Ended()
+		if len(spans) == 0 {
+			t.Fatal("expected spans")
+		}
+
+		lookup := spans[len(spans)-1]
+		if lookup.Name() != "driver.get_resource" {
+			t.Fatalf("expected lookup span to end last, got %v", lookup.Name())
+		}
+
+		attrs := attribute.NewSet(lookup.Attributes()...)
+		if driverName, _ := attrs.Value("driver"); driverName.AsString() != "file" {
+			t.Errorf("got driver attribute %v", driverName.AsString())
+		}
+		if resourceName, _ := attrs.Value("resource"); resourceName.AsString() != "acct:bob@foobar.com" {
+			t.Errorf("got resource attribute %v", resourceName.AsString())
+		}
+
+		for _, span := range spans[:len(spans)-1] {
+			if span.Parent().SpanID() != lookup.SpanContext().SpanID() {
+				t.Errorf("expected %v span to be a child of the lookup span", span.Name())
+			}
+		}
+	})
+}
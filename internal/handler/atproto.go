@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+)
+
+type atprotoHandler struct {
+	Driver        driver.Driver
+	Configuration config.AtprotoConfiguration
+}
+
+func NewAtprotoHandler(driver driver.Driver, conf config.AtprotoConfiguration) Handler {
+	return atprotoHandler{driver, conf}
+}
+
+// Handle serves `/.well-known/atproto-did` for handle verification. Hosts with
+// a configured DID are answered directly, while subdomains of the user domain
+// are looked up as accounts, e.g. `bob.foobar.com` as `acct:bob@foobar.com`.
+func (handler atprotoHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	host := requestHost(r)
+	slog.Info("received request for atproto DID", "host", host)
+
+	if did, ok := handler.Configuration.DIDs[host]; ok {
+		writeDID(w, did)
+		return
+	}
+
+	userDomain := strings.ToLower(handler.Configuration.UserDomain)
+	user, ok := strings.CutSuffix(host, "."+userDomain)
+	if userDomain == "" || !ok || user == "" || strings.Contains(user, ".") {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+
+	res, err := lookupAccount(r.Context(), handler.Driver, user, userDomain)
+	if err != nil {
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			slog.Warn("atproto handle not found", "host", host, "err", err)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+			return
+		}
+
+		slog.Error("error retrieving atproto handle", "host", host, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+		return
+	}
+
+	did, ok := propertyString(res, handler.Configuration.DIDProperty)
+	did = strings.TrimSpace(did)
+	if !ok || !strings.HasPrefix(did, "did:") {
+		slog.Warn("resource has no valid atproto DID", "host", host, "property", handler.Configuration.DIDProperty)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+
+	writeDID(w, did)
+}
+
+func writeDID(w http.ResponseWriter, did string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write([]byte(did))
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestAtprotoHandler(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test/atproto",
+		},
+	}
+
+	handler := NewAtprotoHandler(file.NewFileDriver(conf), config.AtprotoConfiguration{
+		DIDs:        map[string]string{"foobar.com": "did:plc:z72i7hdynmk6r22z27h6tvur"},
+		UserDomain:  "foobar.com",
+		DIDProperty: "https://atproto.com/ns/did",
+	})
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{"serves configured DIDs of hosts", "http://foobar.com/.well-known/atproto-did", http.StatusOK, "did:plc:z72i7hdynmk6r22z27h6tvur"},
+		{"serves DIDs of users", "http://Bob.foobar.com:8008/.well-known/atproto-did", http.StatusOK, "did:plc:ewvi7nxzyoun6zhxrhs64oiz"},
+		{"unknown users return 404", "http://alice.foobar.com/.well-known/atproto-did", http.StatusNotFound, "not found"},
+		{"unknown hosts return 404", "http://example.com/.well-known/atproto-did", http.StatusNotFound, "not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+
+			responseRecorder := httptest.NewRecorder()
+			httpHandler.ServeHTTP(responseRecorder, req)
+
+			if responseRecorder.Code != test.status {
+				t.Fatalf("expected %v, got %v", test.status, responseRecorder.Code)
+			}
+
+			if body := responseRecorder.Body.String(); body != test.body {
+				t.Fatalf("got: %+v,\n want: %+v", body, test.body)
+			}
+		})
+	}
+}
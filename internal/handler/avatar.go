@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/peeley/carpal/internal/driver"
+)
+
+const DEFAULT_AVATAR_MAX_AGE = time.Hour
+
+type avatarHandler struct {
+	Driver driver.AvatarDriver
+	MaxAge time.Duration
+}
+
+func NewAvatarHandler(driver driver.AvatarDriver, maxAge time.Duration) Handler {
+	if maxAge == 0 {
+		maxAge = DEFAULT_AVATAR_MAX_AGE
+	}
+
+	return avatarHandler{driver, maxAge}
+}
+
+// Handle serves the avatar of the user named by the `{user}` path segment.
+func (handler avatarHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	user := r.PathValue("user")
+	slog.Info("received request for avatar", "user", user)
+
+	if user == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("bad request"))
+		return
+	}
+
+	avatar, err := handler.Driver.GetAvatar(user)
+	if err != nil {
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			slog.Warn("avatar not found", "user", user, "err", err)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("avatar not found"))
+			return
+		} else {
+			slog.Error("error retrieving avatar", "user", user, "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+			return
+		}
+	}
+
+	etag := contentETag(avatar.Data)
+
+	setCacheControl(w, handler.MaxAge)
+	w.Header().Set("ETag", etag)
+
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(avatar.Data)
+}
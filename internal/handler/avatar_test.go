@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/driver"
+)
+
+type testAvatarDriver struct{}
+
+func (testAvatarDriver) GetAvatar(user string) (*driver.Avatar, error) {
+	if user != "bob" {
+		return nil, driver.ResourceNotFound{ResourceName: user}
+	}
+
+	return &driver.Avatar{Data: []byte("\x89PNG\r\n\x1a\n"), ContentType: "image/png"}, nil
+}
+
+func TestAvatarHandler(t *testing.T) {
+	handler := NewAvatarHandler(testAvatarDriver{}, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/avatar/{user}", handler.Handle)
+
+	t.Run("can serve avatar with caching headers", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/avatar/bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		mux.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		headers := responseRecorder.Result().Header
+		if headers.Get("Content-Type") != "image/png" {
+			t.Errorf("expected image/png content type, got %v", headers.Get("Content-Type"))
+		}
+
+		if headers.Get("Cache-Control") != "public, max-age=3600" {
+			t.Errorf("unexpected Cache-Control header: %v", headers.Get("Cache-Control"))
+		}
+
+		if headers.Get("ETag") == "" {
+			t.Error("expected ETag header to be set")
+		}
+	})
+
+	t.Run("matching If-None-Match returns 304", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/avatar/bob", nil)
+		responseRecorder := httptest.NewRecorder()
+		mux.ServeHTTP(responseRecorder, req)
+
+		req, _ = http.NewRequest(http.MethodGet, "/avatar/bob", nil)
+		req.Header.Set("If-None-Match", responseRecorder.Header().Get("ETag"))
+		responseRecorder = httptest.NewRecorder()
+		mux.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotModified {
+			t.Fatalf("expected 304, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("weak and listed If-None-Match ETags return 304", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/avatar/bob", nil)
+		responseRecorder := httptest.NewRecorder()
+		mux.ServeHTTP(responseRecorder, req)
+		etag := responseRecorder.Header().Get("ETag")
+
+		for _, header := range []string{"W/" + etag, `"other", ` + etag} {
+			req, _ = http.NewRequest(http.MethodGet, "/avatar/bob", nil)
+			req.Header.Set("If-None-Match", header)
+			responseRecorder = httptest.NewRecorder()
+			mux.ServeHTTP(responseRecorder, req)
+
+			if responseRecorder.Code != http.StatusNotModified {
+				t.Errorf("expected 304 for %q, got %v", header, responseRecorder.Code)
+			}
+		}
+	})
+
+	t.Run("unknown users return 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/avatar/alice", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		mux.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// setCacheControl allows responses to be cached for maxAge.
+func setCacheControl(w http.ResponseWriter, maxAge time.Duration) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+}
+
+// contentETag returns a strong ETag derived from the response body.
+func contentETag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(hash[:16]))
+}
+
+// notModified reports whether the client's copy of the response is still
+// current. As with net/http, If-Modified-Since is only considered if the
+// request has no If-None-Match header.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || modTime.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+
+	// HTTP dates have a resolution of a second
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// etagMatches weakly compares etag against each entry of an If-None-Match
+// header, e.g. `W/"abc", "def"`.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
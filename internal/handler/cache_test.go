@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestResourceHandlerCaching(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test",
+		},
+		CacheConfiguration: &config.CacheConfiguration{
+			MaxAge:         time.Hour,
+			NotFoundMaxAge: time.Minute,
+		},
+	}
+
+	handler, err := NewResourceHandler(file.NewFileDriver(conf), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat("../../test/acct:bob@foobar.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(resource string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/webfinger?resource="+resource, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.Handle(rec, req)
+		return rec
+	}
+
+	first := request("acct:bob@foobar.com", nil)
+	etag := first.Header().Get("ETag")
+
+	t.Run("sets caching headers on found resources", func(t *testing.T) {
+		if first.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", first.Code)
+		}
+
+		if got := first.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+			t.Errorf("got Cache-Control %q", got)
+		}
+
+		if etag == "" {
+			t.Error("expected an ETag")
+		}
+
+		if got, want := first.Header().Get("Last-Modified"), info.ModTime().UTC().Format(http.TimeFormat); got != want {
+			t.Errorf("got Last-Modified %q, want %q", got, want)
+		}
+	})
+
+	t.Run("sets separate max-age on not found resources", func(t *testing.T) {
+		rec := request("missingno", nil)
+
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", rec.Code)
+		}
+
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+			t.Errorf("got Cache-Control %q", got)
+		}
+	})
+
+	t.Run("ETag depends on the filtered links", func(t *testing.T) {
+		rec := request("acct:bob@foobar.com&rel=http://webfinger.example/rel/profile-page", nil)
+
+		if rec.Header().Get("ETag") == etag {
+			t.Error("expected filtered response to have a different ETag")
+		}
+	})
+
+	t.Run("returns 304 on matching If-None-Match", func(t *testing.T) {
+		for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+			rec := request("acct:bob@foobar.com", map[string]string{"If-None-Match": header})
+
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("expected 304 for %q, got %v", header, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("expected empty body for %q", header)
+			}
+			if rec.Header().Get("ETag") != etag {
+				t.Errorf("expected ETag on 304 for %q", header)
+			}
+		}
+	})
+
+	t.Run("returns 200 on stale If-None-Match", func(t *testing.T) {
+		rec := request("acct:bob@foobar.com", map[string]string{
+			"If-None-Match":     `"stale"`,
+			"If-Modified-Since": time.Now().UTC().Format(http.TimeFormat),
+		})
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200 OK, got %v", rec.Code)
+		}
+	})
+
+	t.Run("handles If-Modified-Since", func(t *testing.T) {
+		rec := request("acct:bob@foobar.com", map[string]string{
+			"If-Modified-Since": info.ModTime().UTC().Format(http.TimeFormat),
+		})
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("expected 304, got %v", rec.Code)
+		}
+
+		rec = request("acct:bob@foobar.com", map[string]string{
+			"If-Modified-Since": info.ModTime().Add(-time.Hour).UTC().Format(http.TimeFormat),
+		})
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200 OK, got %v", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/resource"
+)
+
+// findDomainAlias returns the domain alias configured for the host of the
+// given resource, if any.
+func findDomainAlias(aliases []config.DomainAlias, name string) *config.DomainAlias {
+	host := resource.Host(name)
+	if host == "" {
+		return nil
+	}
+
+	for i, alias := range aliases {
+		if strings.EqualFold(alias.From, host) {
+			return &aliases[i]
+		}
+	}
+
+	return nil
+}
+
+// domainAliasRedirectURL returns the same WebFinger request for the resource of
+// the new domain, made to the host the domain alias points to. The resource is
+// rewritten as well, so that the redirect doesn't match the alias again when
+// the new host is served by the same carpal.
+func domainAliasRedirectURL(alias *config.DomainAlias, r *http.Request, name string) string {
+	query := r.URL.Query()
+	query.Set("resource", resource.WithHost(name, alias.To))
+
+	target := url.URL{
+		Scheme:   "https",
+		Host:     alias.To,
+		Path:     r.URL.Path,
+		RawQuery: query.Encode(),
+	}
+
+	return target.String()
+}
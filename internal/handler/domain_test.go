@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestResourceHandlerDomainAliases(t *testing.T) {
+	config := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test",
+		},
+		DomainAliases: []config.DomainAlias{
+			{From: "old.foobar.com", To: "foobar.com", Mode: config.DomainAliasRewrite},
+			{From: "example.org", To: "social.example.org", Mode: config.DomainAliasRedirect, Status: http.StatusTemporaryRedirect},
+			{From: "example.net", To: "foobar.com", Mode: config.DomainAliasRedirect, Status: http.StatusTemporaryRedirect},
+		},
+	}
+
+	handler, err := NewResourceHandler(file.NewFileDriver(config), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	t.Run("rewrites resources of aliased domains", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		query := req.URL.Query()
+		query.Add("resource", "acct:bob@old.foobar.com")
+		query.Add("rel", "none")
+		req.URL.RawQuery = query.Encode()
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"subject":"acct:bob@foobar.com","aliases":["mailto:bob@foobar.com","https://mastodon/bob"],"properties":{"http://webfinger.example/ns/name":"Bob Smith"}}`
+
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("redirects resources of aliased domains to the new host", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct%3Abob%40example.org", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("expected 307, got %v", responseRecorder.Code)
+		}
+
+		location := responseRecorder.Header().Get("Location")
+		want := "https://social.example.org/.well-known/webfinger?resource=acct%3Abob%40social.example.org"
+		if location != want {
+			t.Fatalf("got: %v, want: %v", location, want)
+		}
+	})
+
+	t.Run("redirects do not loop when the new host is served by the same config", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/.well-known/webfinger?resource=acct%3Abob%40example.net&rel=none", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("expected 307, got %v", responseRecorder.Code)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, responseRecorder.Header().Get("Location"), nil)
+
+		responseRecorder = httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK after following the redirect, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"subject":"acct:bob@foobar.com","aliases":["mailto:bob@foobar.com","https://mastodon/bob"],"properties":{"http://webfinger.example/ns/name":"Bob Smith"}}`
+
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"text/template"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/resource"
+)
+
+const (
+	ACTIVITY_JSON_TYPE = "application/activity+json"
+	PROFILE_PAGE_REL   = "http://webfinger.net/rel/profile-page"
+	SUBSCRIBE_REL      = "http://ostatus.org/schema/1.0/subscribe"
+)
+
+var acctPattern = regexp.MustCompile("^acct:([^@]+)@(.+)$")
+
+// fediverseLinks adds the links ActivityPub servers like Mastodon look for to
+// every `acct:` resource.
+type fediverseLinks struct {
+	ActorURL     *template.Template
+	ProfileURL   *template.Template
+	SubscribeURL *template.Template
+}
+
+func newFediverseLinks(conf *config.FediverseConfiguration) (*fediverseLinks, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	parse := func(name string, text string) (*template.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fediverse %s template: %w", name, err)
+		}
+
+		return tmpl, nil
+	}
+
+	actorURL, err := parse("actor_url", conf.ActorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	profileURL, err := parse("profile_url", conf.ProfileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribeURL, err := parse("subscribe_url", conf.SubscribeURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fediverseLinks{
+		ActorURL:     actorURL,
+		ProfileURL:   profileURL,
+		SubscribeURL: subscribeURL,
+	}, nil
+}
+
+func (f *fediverseLinks) addTo(res *resource.Resource) error {
+	if f == nil {
+		return nil
+	}
+
+	account := acctPattern.FindStringSubmatch(res.Subject)
+	if account == nil {
+		return nil
+	}
+
+	data := map[string]string{
+		"user":    account[1],
+		"host":    account[2],
+		"subject": res.Subject,
+	}
+
+	if f.ProfileURL != nil {
+		profileURL, err := render(f.ProfileURL, data)
+		if err != nil {
+			return err
+		}
+
+		addAlias(res, profileURL)
+		addLink(res, resource.Link{Rel: PROFILE_PAGE_REL, Type: stringPtr("text/html"), Href: &profileURL})
+	}
+
+	if f.ActorURL != nil {
+		actorURL, err := render(f.ActorURL, data)
+		if err != nil {
+			return err
+		}
+
+		addAlias(res, actorURL)
+		addLink(res, resource.Link{Rel: "self", Type: stringPtr(ACTIVITY_JSON_TYPE), Href: &actorURL})
+	}
+
+	if f.SubscribeURL != nil {
+		subscribeURL, err := render(f.SubscribeURL, data)
+		if err != nil {
+			return err
+		}
+
+		addLink(res, resource.Link{Rel: SUBSCRIBE_REL, Template: &subscribeURL})
+	}
+
+	return nil
+}
+
+func render(tmpl *template.Template, data any) (string, error) {
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template: %w", tmpl.Name(), err)
+	}
+
+	return rendered.String(), nil
+}
+
+func addAlias(res *resource.Resource, alias string) {
+	if !slices.Contains(res.Aliases, alias) {
+		res.Aliases = append(res.Aliases, alias)
+	}
+}
+
+// addLink appends the link, unless the resource already has a link with the
+// same relation and type.
+func addLink(res *resource.Resource, link resource.Link) {
+	exists := slices.ContainsFunc(res.Links, func(existing resource.Link) bool {
+		return existing.Rel == link.Rel && (link.Type == nil || existing.Type != nil && *existing.Type == *link.Type)
+	})
+
+	if !exists {
+		res.Links = append(res.Links, link)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestResourceHandlerFediverseLinks(t *testing.T) {
+	config := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test",
+		},
+		FediverseConfiguration: &config.FediverseConfiguration{
+			ActorURL:     "https://social.foobar.com/users/{{ .user }}",
+			ProfileURL:   "https://social.foobar.com/@{{ .user }}",
+			SubscribeURL: "https://social.foobar.com/authorize_interaction?uri={uri}",
+		},
+	}
+
+	handler, err := NewResourceHandler(file.NewFileDriver(config), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	t.Run("adds ActivityPub links and aliases to acct resources", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		query := req.URL.Query()
+		query.Add("resource", "acct:bob@foobar.com")
+		query.Add("rel", "self")
+		query.Add("rel", SUBSCRIBE_REL)
+		req.URL.RawQuery = query.Encode()
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"subject":"acct:bob@foobar.com","aliases":["mailto:bob@foobar.com","https://mastodon/bob","https://social.foobar.com/@bob","https://social.foobar.com/users/bob"],"properties":{"http://webfinger.example/ns/name":"Bob Smith"},"links":[{"rel":"self","type":"application/activity+json","href":"https://social.foobar.com/users/bob"},{"rel":"http://ostatus.org/schema/1.0/subscribe","template":"https://social.foobar.com/authorize_interaction?uri={uri}"}]}`
+
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+)
+
+const (
+	DEFAULT_HEALTH_TIMEOUT   = 2 * time.Second
+	DEFAULT_HEALTH_CACHE_TTL = 5 * time.Second
+	healthStatusOK           = "ok"
+	healthStatusUnavailable  = "unavailable"
+)
+
+type componentHealth struct {
+	Status string `json:"status"`
+}
+
+type healthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentHealth `json:"components,omitempty"`
+}
+
+type livenessHandler struct{}
+
+func NewLivenessHandler() Handler {
+	return livenessHandler{}
+}
+
+// Handle confirms the process is serving requests, without checking the
+// driver's backend.
+func (handler livenessHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	writeJSON(w, "application/json", healthResponse{Status: healthStatusOK})
+}
+
+type readinessHandler struct {
+	Checks  map[string]driver.HealthChecker
+	Timeout time.Duration
+	cache   *healthCache
+}
+
+// NewReadinessHandler returns a handler running the given health checks, keyed
+// by the name of the component they check.
+func NewReadinessHandler(checks map[string]driver.HealthChecker, conf config.HealthConfiguration) Handler {
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_HEALTH_TIMEOUT
+	}
+
+	cacheTTL := conf.CacheTTL
+	if cacheTTL == 0 {
+		cacheTTL = DEFAULT_HEALTH_CACHE_TTL
+	}
+
+	return readinessHandler{checks, timeout, &healthCache{ttl: cacheTTL}}
+}
+
+// Handle reports the status of every component, responding with 503 if any of
+// them is unavailable. Failures are only logged, to avoid exposing details of
+// the backends.
+func (handler readinessHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	response := handler.cache.get(handler.check)
+
+	status := http.StatusOK
+	if response.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSONStatus(w, "application/json", status, response)
+}
+
+// check runs every health check concurrently, each with its own timeout.
+func (handler readinessHandler) check() healthResponse {
+	response := healthResponse{
+		Status:     healthStatusOK,
+		Components: make(map[string]componentHealth, len(handler.Checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range handler.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), handler.Timeout)
+			defer cancel()
+
+			status := healthStatusOK
+			if err := checker.CheckHealth(ctx); err != nil {
+				slog.Error("health check failed", "component", name, "err", err)
+				status = healthStatusUnavailable
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			response.Components[name] = componentHealth{Status: status}
+			if status != healthStatusOK {
+				response.Status = healthStatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	return response
+}
+
+// healthCache holds the last readiness result, so that frequent probes don't
+// each hit the backends.
+type healthCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	response  healthResponse
+	checkedAt time.Time
+}
+
+func (c *healthCache) get(check func() healthResponse) healthResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.ttl {
+		return c.response
+	}
+
+	c.response = check()
+	c.checkedAt = time.Now()
+
+	return c.response
+}
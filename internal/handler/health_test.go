@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+)
+
+type fakeHealthChecker struct {
+	err   error
+	calls *int
+}
+
+func (c fakeHealthChecker) CheckHealth(ctx context.Context) error {
+	*c.calls++
+	return c.err
+}
+
+func TestLivenessHandler(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/healthz", nil)
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(NewLivenessHandler().Handle).ServeHTTP(responseRecorder, req)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+	}
+}
+
+func TestReadinessHandler(t *testing.T) {
+	t.Run("reports every component as ok", func(t *testing.T) {
+		calls := 0
+		handler := NewReadinessHandler(map[string]driver.HealthChecker{
+			"sql": fakeHealthChecker{calls: &calls},
+		}, config.HealthConfiguration{})
+
+		responseRecorder := serveReadiness(handler)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"status":"ok","components":{"sql":{"status":"ok"}}}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("returns 503 if any component is unavailable", func(t *testing.T) {
+		calls := 0
+		handler := NewReadinessHandler(map[string]driver.HealthChecker{
+			"ldap": fakeHealthChecker{err: errors.New("connection refused"), calls: &calls},
+		}, config.HealthConfiguration{})
+
+		responseRecorder := serveReadiness(handler)
+
+		if responseRecorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"status":"unavailable","components":{"ldap":{"status":"unavailable"}}}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("caches results", func(t *testing.T) {
+		calls := 0
+		handler := NewReadinessHandler(map[string]driver.HealthChecker{
+			"file": fakeHealthChecker{calls: &calls},
+		}, config.HealthConfiguration{CacheTTL: time.Minute})
+
+		serveReadiness(handler)
+		serveReadiness(handler)
+
+		if calls != 1 {
+			t.Errorf("expected a single health check, got %v", calls)
+		}
+	})
+}
+
+func serveReadiness(handler Handler) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/readyz", nil)
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(handler.Handle).ServeHTTP(responseRecorder, req)
+
+	return responseRecorder
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DEFAULT_LIGHTNING_TIMEOUT = 10 * time.Second
+	maxLightningResponseSize  = 1 << 20
+)
+
+var lightningUserPattern = regexp.MustCompile("^[a-z0-9._+-]+$")
+
+// lightningError is the error response defined by LUD-06.
+type lightningError struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type lightningHandler struct {
+	Driver        driver.Driver
+	Configuration config.LightningConfiguration
+	Template      *template.Template
+	BackendURL    *template.Template
+	Client        *http.Client
+}
+
+// NewLightningHandler returns a handler serving Lightning Addresses, either by
+// rendering the LNURL-pay response from the configured template, or by
+// proxying the request to the configured LNURL backend.
+func NewLightningHandler(driver driver.Driver, conf config.LightningConfiguration) (Handler, error) {
+	handler := lightningHandler{Driver: driver, Configuration: conf}
+
+	if conf.Template != "" {
+		tmpl, err := template.New("lightning").Parse(conf.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lightning template: %w", err)
+		}
+
+		handler.Template = tmpl
+	}
+
+	if conf.BackendURL != "" {
+		timeout := conf.Timeout
+		if timeout == 0 {
+			timeout = DEFAULT_LIGHTNING_TIMEOUT
+		}
+
+		backendURL, err := template.New("backend_url").Parse(conf.BackendURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lightning backend_url template: %w", err)
+		}
+
+		handler.BackendURL = backendURL
+		handler.Client = &http.Client{Timeout: timeout}
+	}
+
+	return handler, nil
+}
+
+// Handle serves LUD-16 `/.well-known/lnurlp/{user}` requests for the account
+// `acct:<user>@<domain>`.
+func (handler lightningHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	user := strings.ToLower(r.PathValue("user"))
+	slog.Info("received request for lightning address", "user", user)
+
+	if !lightningUserPattern.MatchString(user) {
+		writeLightningError(w, http.StatusBadRequest, "invalid user")
+		return
+	}
+
+	domain := handler.Configuration.Domain
+	if domain == "" {
+		domain = requestHost(r)
+	}
+
+	res, err := lookupAccount(r.Context(), handler.Driver, user, domain)
+	if err != nil {
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			slog.Warn("lightning address not found", "user", user, "err", err)
+			writeLightningError(w, http.StatusNotFound, "user not found")
+			return
+		}
+
+		slog.Error("error retrieving lightning address", "user", user, "err", err)
+		writeLightningError(w, http.StatusBadGateway, "bad gateway")
+		return
+	}
+
+	data := map[string]any{
+		"user":       user,
+		"host":       domain,
+		"subject":    res.Subject,
+		"properties": res.Properties,
+	}
+
+	if handler.BackendURL != nil {
+		handler.proxy(w, data)
+		return
+	}
+
+	response, err := handler.render(data)
+	if err != nil {
+		slog.Error("unable to render lightning response", "user", user, "err", err)
+		writeLightningError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	writeJSON(w, "application/json", response)
+}
+
+// render executes the response template, which may be written in either YAML
+// or JSON, and returns the parsed response.
+func (handler lightningHandler) render(data map[string]any) (any, error) {
+	rendered, err := render(handler.Template, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var response any
+	if err := yaml.Unmarshal([]byte(rendered), &response); err != nil {
+		return nil, fmt.Errorf("could not unmarshal lightning response: %w", err)
+	}
+
+	return response, nil
+}
+
+func (handler lightningHandler) proxy(w http.ResponseWriter, data map[string]any) {
+	backendURL, err := render(handler.BackendURL, data)
+	if err != nil {
+		slog.Error("unable to render lightning backend URL", "err", err)
+		writeLightningError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	backendResponse, err := handler.Client.Get(backendURL)
+	if err != nil {
+		slog.Error("error requesting lightning backend", "url", backendURL, "err", err)
+		writeLightningError(w, http.StatusBadGateway, "bad gateway")
+		return
+	}
+	defer backendResponse.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(backendResponse.Body, maxLightningResponseSize))
+	if err != nil {
+		slog.Error("error reading lightning backend response", "url", backendURL, "err", err)
+		writeLightningError(w, http.StatusBadGateway, "bad gateway")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(backendResponse.StatusCode)
+	w.Write(body)
+}
+
+func writeLightningError(w http.ResponseWriter, status int, reason string) {
+	writeJSONStatus(w, "application/json", status, lightningError{Status: "ERROR", Reason: reason})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestLightningHandler(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test/nostr",
+		},
+	}
+	fileDriver := file.NewFileDriver(conf)
+
+	t.Run("renders the response template", func(t *testing.T) {
+		handler, err := NewLightningHandler(fileDriver, config.LightningConfiguration{
+			Template: `
+tag: payRequest
+callback: "https://pay.foobar.com/callback/{{ .user }}"
+minSendable: 1000
+maxSendable: 100000000
+metadata: '[["text/identifier","{{ .user }}@{{ .host }}"]]'
+`,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := serveLightning(handler, "http://foobar.com/.well-known/lnurlp/bob", "bob")
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"callback":"https://pay.foobar.com/callback/bob","maxSendable":100000000,"metadata":"[[\"text/identifier\",\"bob@foobar.com\"]]","minSendable":1000,"tag":"payRequest"}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("proxies to the backend", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"tag":"payRequest","path":"` + r.URL.Path + `"}`))
+		}))
+		defer backend.Close()
+
+		handler, err := NewLightningHandler(fileDriver, config.LightningConfiguration{
+			BackendURL: backend.URL + "/lnurlp/{{ .user }}",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := serveLightning(handler, "http://foobar.com/.well-known/lnurlp/bob", "bob")
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"tag":"payRequest","path":"/lnurlp/bob"}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("unknown users return 404", func(t *testing.T) {
+		handler, err := NewLightningHandler(fileDriver, config.LightningConfiguration{Template: "tag: payRequest"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		responseRecorder := serveLightning(handler, "http://foobar.com/.well-known/lnurlp/alice", "alice")
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"status":"ERROR","reason":"user not found"}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+}
+
+func serveLightning(handler Handler, url string, user string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.SetPathValue("user", user)
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(handler.Handle).ServeHTTP(responseRecorder, req)
+
+	return responseRecorder
+}
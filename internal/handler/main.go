@@ -4,8 +4,11 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/peeley/carpal/internal/config"
 	"github.com/peeley/carpal/internal/driver"
+	"github.com/peeley/carpal/internal/metrics"
 	"github.com/peeley/carpal/internal/resource"
 )
 
@@ -14,11 +17,18 @@ type Handler interface {
 }
 
 type resourceHandler struct {
-	Driver driver.Driver
+	Driver        driver.Driver
+	Configuration config.Configuration
+	Fediverse     *fediverseLinks
 }
 
-func NewResourceHandler(driver driver.Driver) Handler {
-	return resourceHandler{driver}
+func NewResourceHandler(driver driver.Driver, conf config.Configuration) (Handler, error) {
+	fediverse, err := newFediverseLinks(conf.FediverseConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	return resourceHandler{driver, conf, fediverse}, nil
 }
 
 func (handler resourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
@@ -38,10 +48,40 @@ func (handler resourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resourceStruct, err := handler.Driver.GetResource(resourceParam)
+	if alias := findDomainAlias(handler.Configuration.DomainAliases, resourceParam); alias != nil {
+		if alias.Mode == config.DomainAliasRedirect {
+			redirectURL := domainAliasRedirectURL(alias, r, resourceParam)
+			slog.Info("redirecting request for aliased domain", "resource_name", resourceParam, "location", redirectURL)
+			http.Redirect(w, r, redirectURL, alias.Status)
+			return
+		}
+
+		rewritten := resource.WithHost(resourceParam, alias.To)
+		slog.Debug("rewriting request for aliased domain", "resource_name", resourceParam, "rewritten", rewritten)
+		resourceParam = rewritten
+	}
+
+	relParams := r.URL.Query()["rel"]
+	metrics.ObserveWebFingerRequest(len(relParams) != 0)
+
+	lookupStart := time.Now()
+	resourceStruct, err := getResource(r.Context(), handler.Driver, resourceParam)
+	metrics.ObserveLookup(handler.Configuration.Driver, lookupStart, err)
+	if err == nil {
+		err = handler.addGeneratedLinks(resourceStruct)
+	} else if errors.As(err, &driver.ResourceNotFound{}) {
+		issuerResource := unknownOpenIDResource(handler.Configuration.OpenIDConfiguration, resourceParam, relParams)
+		if issuerResource != nil {
+			slog.Info("answering issuer query for unknown resource", "resource_name", resourceParam)
+			resourceStruct, err = issuerResource, nil
+		}
+	}
 	if err != nil {
 		if errors.As(err, &driver.ResourceNotFound{}) {
 			slog.Warn("resource not found", "resource_name", resourceParam, "err", err)
+			if cache := handler.Configuration.CacheConfiguration; cache != nil {
+				setCacheControl(w, cache.NotFoundMaxAge)
+			}
 			w.WriteHeader(http.StatusNotFound)
 			w.Write([]byte(err.Error()))
 			return
@@ -53,7 +93,6 @@ func (handler resourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	relParams := r.URL.Query()["rel"]
 	if len(relParams) != 0 {
 		relParamsSet := make(map[string]bool)
 		for _, rel := range(relParams) {
@@ -80,7 +119,30 @@ func (handler resourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cache := handler.Configuration.CacheConfiguration; cache != nil {
+		setCacheControl(w, cache.MaxAge)
+	}
+
+	etag := contentETag(JRD)
+	w.Header().Set("ETag", etag)
+	if !resourceStruct.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", resourceStruct.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, resourceStruct.ModTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Add("Content-Type", "application/jrd+json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(JRD)
 }
+
+// addGeneratedLinks adds the links carpal generates from its configuration to
+// a resource returned by the driver.
+func (handler resourceHandler) addGeneratedLinks(res *resource.Resource) error {
+	addOpenIDIssuer(handler.Configuration.OpenIDConfiguration, res)
+
+	return handler.Fediverse.addTo(res)
+}
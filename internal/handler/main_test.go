@@ -19,7 +19,10 @@ func TestResourceHandlerFileDriver(t *testing.T) {
 
 	fileDriver := file.NewFileDriver(config)
 
-	handler := NewResourceHandler(fileDriver)
+	handler, err := NewResourceHandler(fileDriver, config)
+	if err != nil {
+		t.Fatal(err)
+	}
 	httpHandler := http.HandlerFunc(handler.Handle)
 
 	t.Run("can retrieve resources and serve via http", func(t *testing.T) {
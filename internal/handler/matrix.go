@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"maps"
+	"net/http"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+type matrixHandler struct {
+	Configuration config.MatrixConfiguration
+}
+
+func NewMatrixHandler(conf config.MatrixConfiguration) Handler {
+	return matrixHandler{conf}
+}
+
+// Handle serves the Matrix server delegation at `/.well-known/matrix/server`
+// and the client discovery at `/.well-known/matrix/client`.
+func (handler matrixHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	conf := handler.Configuration
+
+	switch r.URL.Path {
+	case "/.well-known/matrix/server":
+		if conf.Server == "" {
+			break
+		}
+
+		writeJSON(w, "application/json", map[string]string{"m.server": conf.Server})
+		return
+
+	case "/.well-known/matrix/client":
+		if conf.HomeserverURL == "" && len(conf.Client) == 0 {
+			break
+		}
+
+		client := map[string]any{}
+		maps.Copy(client, conf.Client)
+		if conf.HomeserverURL != "" {
+			client["m.homeserver"] = map[string]string{"base_url": conf.HomeserverURL}
+		}
+		if conf.IdentityServerURL != "" {
+			client["m.identity_server"] = map[string]string{"base_url": conf.IdentityServerURL}
+		}
+
+		writeJSON(w, "application/json", client)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("not found"))
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestMatrixHandler(t *testing.T) {
+	handler := NewMatrixHandler(config.MatrixConfiguration{
+		Server:        "matrix.foobar.com:443",
+		HomeserverURL: "https://matrix.foobar.com",
+		Client: map[string]any{
+			"org.matrix.msc3575.proxy": map[string]any{"url": "https://sync.foobar.com"},
+		},
+	})
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"serves server delegation", "/.well-known/matrix/server", `{"m.server":"matrix.foobar.com:443"}`},
+		{"serves client discovery", "/.well-known/matrix/client", `{"m.homeserver":{"base_url":"https://matrix.foobar.com"},"org.matrix.msc3575.proxy":{"url":"https://sync.foobar.com"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://foobar.com"+test.path, nil)
+
+			responseRecorder := httptest.NewRecorder()
+			httpHandler.ServeHTTP(responseRecorder, req)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+			}
+
+			if responseRecorder.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Errorf("expected CORS header to allow any origin")
+			}
+
+			if body := responseRecorder.Body.String(); body != test.body {
+				t.Fatalf("got: %+v,\n want: %+v", body, test.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+)
+
+const (
+	NODEINFO_SCHEMA_REL      = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+	NODEINFO_PATH            = "/nodeinfo/2.1"
+	NODEINFO_CONTENT_TYPE    = `application/json; profile="http://nodeinfo.diaspora.software/ns/schema/2.1#"`
+	DEFAULT_COUNT_CACHE_TTL  = 5 * time.Minute
+	DEFAULT_SOFTWARE_NAME    = "carpal"
+	DEFAULT_SOFTWARE_VERSION = "unknown"
+)
+
+type nodeInfoSoftware struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+type nodeInfoServices struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+type nodeInfoUsers struct {
+	Total          *int `json:"total,omitempty"`
+	ActiveHalfyear *int `json:"activeHalfyear,omitempty"`
+	ActiveMonth    *int `json:"activeMonth,omitempty"`
+}
+
+type nodeInfoUsage struct {
+	Users         nodeInfoUsers `json:"users"`
+	LocalPosts    *int          `json:"localPosts,omitempty"`
+	LocalComments *int          `json:"localComments,omitempty"`
+}
+
+type nodeInfoDocument struct {
+	Version           string           `json:"version"`
+	Software          nodeInfoSoftware `json:"software"`
+	Protocols         []string         `json:"protocols"`
+	Services          nodeInfoServices `json:"services"`
+	OpenRegistrations bool             `json:"openRegistrations"`
+	Usage             nodeInfoUsage    `json:"usage"`
+	Metadata          map[string]any   `json:"metadata"`
+}
+
+type nodeInfoDiscoveryHandler struct {
+	Configuration config.NodeInfoConfiguration
+}
+
+func NewNodeInfoDiscoveryHandler(conf config.NodeInfoConfiguration) Handler {
+	return nodeInfoDiscoveryHandler{conf}
+}
+
+// Handle serves the `/.well-known/nodeinfo` document pointing to the NodeInfo
+// 2.1 document.
+func (handler nodeInfoDiscoveryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	discovery := map[string]any{
+		"links": []map[string]string{
+			{
+				"rel":  NODEINFO_SCHEMA_REL,
+				"href": baseURL(handler.Configuration.BaseURL, r) + NODEINFO_PATH,
+			},
+		},
+	}
+
+	writeJSON(w, "application/json", discovery)
+}
+
+type nodeInfoHandler struct {
+	Configuration config.NodeInfoConfiguration
+	Counter       driver.UserCounter
+	cache         *userCountCache
+}
+
+// NewNodeInfoHandler returns a handler serving the NodeInfo 2.1 document. If
+// counter is not nil, the total user count is taken from it.
+func NewNodeInfoHandler(conf config.NodeInfoConfiguration, counter driver.UserCounter) Handler {
+	ttl := conf.CountCacheTTL
+	if ttl == 0 {
+		ttl = DEFAULT_COUNT_CACHE_TTL
+	}
+
+	return nodeInfoHandler{conf, counter, &userCountCache{ttl: ttl}}
+}
+
+func (handler nodeInfoHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	conf := handler.Configuration
+	document := nodeInfoDocument{
+		Version: "2.1",
+		Software: nodeInfoSoftware{
+			Name:       conf.Software.Name,
+			Version:    conf.Software.Version,
+			Repository: conf.Software.Repository,
+			Homepage:   conf.Software.Homepage,
+		},
+		Protocols: nonNil(conf.Protocols),
+		Services: nodeInfoServices{
+			Inbound:  nonNil(conf.Services.Inbound),
+			Outbound: nonNil(conf.Services.Outbound),
+		},
+		OpenRegistrations: conf.OpenRegistrations,
+		Usage: nodeInfoUsage{
+			Users: nodeInfoUsers{
+				Total:          conf.Usage.Users.Total,
+				ActiveHalfyear: conf.Usage.Users.ActiveHalfyear,
+				ActiveMonth:    conf.Usage.Users.ActiveMonth,
+			},
+			LocalPosts:    conf.Usage.LocalPosts,
+			LocalComments: conf.Usage.LocalComments,
+		},
+		Metadata: conf.Metadata,
+	}
+
+	if document.Software.Name == "" {
+		document.Software.Name = DEFAULT_SOFTWARE_NAME
+	}
+	if document.Software.Version == "" {
+		document.Software.Version = DEFAULT_SOFTWARE_VERSION
+	}
+	if document.Metadata == nil {
+		document.Metadata = map[string]any{}
+	}
+
+	if handler.Counter != nil {
+		total, err := handler.cache.get(handler.Counter)
+		if err != nil {
+			slog.Error("unable to count users", "err", err)
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway"))
+			return
+		}
+		document.Usage.Users.Total = &total
+	}
+
+	writeJSON(w, NODEINFO_CONTENT_TYPE, document)
+}
+
+// userCountCache holds the last user count, so that NodeInfo requests don't
+// each have to count every user in the backend.
+type userCountCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	count     int
+	fetchedAt time.Time
+}
+
+func (c *userCountCache) get(counter driver.UserCounter) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.fetchedAt.IsZero() && time.Since(c.fetchedAt) < c.ttl {
+		return c.count, nil
+	}
+
+	count, err := counter.CountUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	c.count = count
+	c.fetchedAt = time.Now()
+
+	return count, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
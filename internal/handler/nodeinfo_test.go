@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+type testUserCounter struct {
+	calls *int
+}
+
+func (c testUserCounter) CountUsers() (int, error) {
+	*c.calls++
+	return 42, nil
+}
+
+func TestNodeInfoHandlers(t *testing.T) {
+	activeMonth := 7
+	conf := config.NodeInfoConfiguration{
+		Software:  config.NodeInfoSoftware{Name: "carpal", Version: "1.0.0"},
+		Protocols: []string{"activitypub"},
+		Usage: config.NodeInfoUsage{
+			Users: config.NodeInfoUsers{ActiveMonth: &activeMonth},
+		},
+		Metadata: map[string]any{"nodeName": "foobar"},
+	}
+
+	t.Run("discovery document links to the nodeinfo document", func(t *testing.T) {
+		handler := NewNodeInfoDiscoveryHandler(conf)
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/nodeinfo", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		http.HandlerFunc(handler.Handle).ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"links":[{"href":"http://foobar.com/nodeinfo/2.1","rel":"http://nodeinfo.diaspora.software/ns/schema/2.1"}]}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("nodeinfo document includes user count from the driver", func(t *testing.T) {
+		calls := 0
+		handler := NewNodeInfoHandler(conf, testUserCounter{&calls})
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, "/nodeinfo/2.1", nil)
+
+			responseRecorder := httptest.NewRecorder()
+			http.HandlerFunc(handler.Handle).ServeHTTP(responseRecorder, req)
+
+			if responseRecorder.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+			}
+
+			if responseRecorder.Header().Get("Content-Type") != NODEINFO_CONTENT_TYPE {
+				t.Fatalf("unexpected content type: %v", responseRecorder.Header().Get("Content-Type"))
+			}
+
+			body := responseRecorder.Body.String()
+			want := `{"version":"2.1","software":{"name":"carpal","version":"1.0.0"},"protocols":["activitypub"],"services":{"inbound":[],"outbound":[]},"openRegistrations":false,"usage":{"users":{"total":42,"activeMonth":7}},"metadata":{"nodeName":"foobar"}}`
+			if body != want {
+				t.Fatalf("got: %+v,\n want: %+v", body, want)
+			}
+		}
+
+		if calls != 1 {
+			t.Errorf("expected user count to be cached, counted %d times", calls)
+		}
+	})
+}
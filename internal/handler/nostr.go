@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+)
+
+var (
+	nostrNamePattern   = regexp.MustCompile("^[a-z0-9._-]+$")
+	nostrPubkeyPattern = regexp.MustCompile("^[0-9a-f]{64}$")
+)
+
+type nostrResponse struct {
+	Names  map[string]string   `json:"names"`
+	Relays map[string][]string `json:"relays,omitempty"`
+}
+
+type nostrHandler struct {
+	Driver        driver.Driver
+	Configuration config.NostrConfiguration
+}
+
+func NewNostrHandler(driver driver.Driver, conf config.NostrConfiguration) Handler {
+	return nostrHandler{driver, conf}
+}
+
+// Handle serves NIP-05 `/.well-known/nostr.json?name=bob` lookups, reading the
+// public key and relays of `acct:bob@<domain>` from its properties.
+func (handler nostrHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	name := strings.ToLower(r.URL.Query().Get("name"))
+	slog.Info("received request for nostr identifier", "name", name)
+
+	if !nostrNamePattern.MatchString(name) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("bad request"))
+		return
+	}
+
+	domain := handler.Configuration.Domain
+	if domain == "" {
+		domain = requestHost(r)
+	}
+
+	res, err := lookupAccount(r.Context(), handler.Driver, name, domain)
+	if err != nil {
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			slog.Warn("nostr identifier not found", "name", name, "err", err)
+			writeJSONStatus(w, "application/json", http.StatusNotFound, nostrResponse{Names: map[string]string{}})
+			return
+		}
+
+		slog.Error("error retrieving nostr identifier", "name", name, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+		return
+	}
+
+	pubkey, ok := propertyString(res, handler.Configuration.PubkeyProperty)
+	pubkey = strings.ToLower(strings.TrimSpace(pubkey))
+	if !ok || !nostrPubkeyPattern.MatchString(pubkey) {
+		slog.Warn("resource has no valid nostr public key", "name", name, "property", handler.Configuration.PubkeyProperty)
+		writeJSONStatus(w, "application/json", http.StatusNotFound, nostrResponse{Names: map[string]string{}})
+		return
+	}
+
+	response := nostrResponse{Names: map[string]string{name: pubkey}}
+	if relays := handler.relays(res.Properties[handler.Configuration.RelaysProperty]); len(relays) != 0 {
+		response.Relays = map[string][]string{pubkey: relays}
+	}
+
+	writeJSON(w, "application/json", response)
+}
+
+// relays accepts either a list of relays, or a single string of relays
+// separated by whitespace or commas.
+func (handler nostrHandler) relays(property any) []string {
+	relays := []string{}
+
+	switch value := property.(type) {
+	case string:
+		relays = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})
+	case []any:
+		for _, relay := range value {
+			if relayString, ok := relay.(string); ok && relayString != "" {
+				relays = append(relays, relayString)
+			}
+		}
+	}
+
+	return relays
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestNostrHandler(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test/nostr",
+		},
+	}
+
+	handler := NewNostrHandler(file.NewFileDriver(conf), config.NostrConfiguration{
+		PubkeyProperty: "https://nostr.com/ns/pubkey",
+		RelaysProperty: "https://nostr.com/ns/relays",
+	})
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	t.Run("serves public key and relays of known names", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com:8008/.well-known/nostr.json?name=Bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		if responseRecorder.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("expected CORS header to allow any origin")
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"names":{"bob":"b0635d6a9851d3aed0cd6c495b282167acf761729078d975fc341b22650b07b9"},"relays":{"b0635d6a9851d3aed0cd6c495b282167acf761729078d975fc341b22650b07b9":["wss://relay.foobar.com","wss://relay.example.com"]}}`
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("unknown names return 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/nostr.json?name=alice", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("invalid names return 400", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/nostr.json?name=../bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %v", responseRecorder.Code)
+		}
+	})
+}
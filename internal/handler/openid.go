@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"slices"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/resource"
+)
+
+const OPENID_ISSUER_REL = "http://openid.net/specs/connect/1.0/issuer"
+
+// openIDIssuer returns the OpenID Connect issuer for the domain of the given
+// resource, or an empty string if none is configured.
+func openIDIssuer(conf *config.OpenIDConfiguration, name string) string {
+	if conf == nil {
+		return ""
+	}
+
+	if issuer, ok := conf.Issuers[resource.Host(name)]; ok {
+		return issuer
+	}
+
+	return conf.Issuer
+}
+
+// addOpenIDIssuer adds the issuer link to the resource, unless the resource
+// already has one of its own.
+func addOpenIDIssuer(conf *config.OpenIDConfiguration, res *resource.Resource) {
+	issuer := openIDIssuer(conf, res.Subject)
+	if issuer == "" {
+		return
+	}
+
+	addLink(res, resource.Link{Rel: OPENID_ISSUER_REL, Href: &issuer})
+}
+
+// unknownOpenIDResource returns a resource holding just the issuer link, for
+// issuer queries about resources the driver doesn't know, if allowed.
+func unknownOpenIDResource(conf *config.OpenIDConfiguration, name string, rels []string) *resource.Resource {
+	if conf == nil || !conf.AnswerUnknown || !slices.Contains(rels, OPENID_ISSUER_REL) {
+		return nil
+	}
+
+	issuer := openIDIssuer(conf, name)
+	if issuer == "" {
+		return nil
+	}
+
+	return &resource.Resource{
+		Subject: name,
+		Links:   []resource.Link{{Rel: OPENID_ISSUER_REL, Href: &issuer}},
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver/file"
+)
+
+func TestResourceHandlerOpenIDIssuer(t *testing.T) {
+	config := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory: "../../test",
+		},
+		OpenIDConfiguration: &config.OpenIDConfiguration{
+			Issuer: "https://sso.example.com/realms/default",
+			Issuers: map[string]string{
+				"foobar.com": "https://sso.example.com/realms/foobar",
+			},
+			AnswerUnknown: true,
+		},
+	}
+
+	handler, err := NewResourceHandler(file.NewFileDriver(config), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpHandler := http.HandlerFunc(handler.Handle)
+
+	t.Run("injects the issuer for the resource's domain", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		query := req.URL.Query()
+		query.Add("resource", "acct:bob@foobar.com")
+		query.Add("rel", OPENID_ISSUER_REL)
+		req.URL.RawQuery = query.Encode()
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"subject":"acct:bob@foobar.com","aliases":["mailto:bob@foobar.com","https://mastodon/bob"],"properties":{"http://webfinger.example/ns/name":"Bob Smith"},"links":[{"rel":"http://openid.net/specs/connect/1.0/issuer","href":"https://sso.example.com/realms/foobar"}]}`
+
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("answers issuer queries for unknown resources", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		query := req.URL.Query()
+		query.Add("resource", "acct:alice@example.com")
+		query.Add("rel", OPENID_ISSUER_REL)
+		req.URL.RawQuery = query.Encode()
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		want := `{"subject":"acct:alice@example.com","links":[{"rel":"http://openid.net/specs/connect/1.0/issuer","href":"https://sso.example.com/realms/default"}]}`
+
+		if body != want {
+			t.Fatalf("got: %+v,\n want: %+v", body, want)
+		}
+	})
+
+	t.Run("unknown resources without an issuer query still return 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		query := req.URL.Query()
+		query.Add("resource", "acct:alice@example.com")
+		req.URL.RawQuery = query.Encode()
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// baseURL returns the configured public URL of carpal, or one derived from the
+// request if none is configured.
+func baseURL(configured string, r *http.Request) string {
+	if configured != "" {
+		return strings.TrimSuffix(configured, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, body any) {
+	writeJSONStatus(w, contentType, http.StatusOK, body)
+}
+
+func writeJSONStatus(w http.ResponseWriter, contentType string, status int, body any) {
+	jsonBytes, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("unable to marshal response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal server error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
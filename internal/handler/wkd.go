@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+	"github.com/peeley/carpal/internal/wkd"
+)
+
+const (
+	WKD_PATH          = "/.well-known/openpgpkey/"
+	wkdKeyContentType = "application/octet-stream"
+)
+
+type wkdHandler struct {
+	Driver        driver.OpenPGPKeyDriver
+	Configuration config.WKDConfiguration
+}
+
+func NewWKDHandler(driver driver.OpenPGPKeyDriver, conf config.WKDConfiguration) Handler {
+	return wkdHandler{driver, conf}
+}
+
+// Handle serves OpenPGP keys in both the direct layout, i.e.
+// `/.well-known/openpgpkey/hu/<hash>?l=bob` for the requested host, and the
+// advanced layout, i.e. `/.well-known/openpgpkey/<domain>/hu/<hash>?l=bob`.
+// Requests without the `l` parameter are only answered if the driver can look
+// keys up by hash.
+func (handler wkdHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("method not allowed"))
+		return
+	}
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, WKD_PATH), "/")
+
+	domain := requestHost(r)
+	if len(segments) == 3 || len(segments) == 2 && segments[1] == "policy" {
+		domain = strings.ToLower(segments[0])
+		segments = segments[1:]
+	}
+
+	if len(segments) == 1 && segments[0] == "policy" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(handler.Configuration.Policy))
+		return
+	}
+
+	if len(segments) != 2 || segments[0] != "hu" || domain == "" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+
+	// the hash of the local part can't be reversed, so unless the driver can
+	// look keys up by hash, clients have to send the local part along as the
+	// `l` parameter.
+	hash := segments[1]
+	user := strings.ToLower(r.URL.Query().Get("l"))
+	slog.Info("received request for OpenPGP key", "hash", hash, "user", user, "domain", domain)
+
+	hashDriver, byHash := handler.Driver.(driver.OpenPGPKeyHashDriver)
+	if user == "" && !byHash || user != "" && wkd.Hash(user) != hash {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+
+	var key []byte
+	var err error
+	if user == "" {
+		key, err = hashDriver.GetOpenPGPKeyByHash(hash, domain)
+	} else {
+		key, err = handler.Driver.GetOpenPGPKey(user, domain)
+	}
+	if err != nil {
+		if errors.As(err, &driver.ResourceNotFound{}) {
+			slog.Warn("OpenPGP key not found", "user", user, "domain", domain, "err", err)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+			return
+		}
+
+		slog.Error("error retrieving OpenPGP key", "user", user, "domain", domain, "err", err)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+		return
+	}
+
+	w.Header().Set("Content-Type", wkdKeyContentType)
+	w.Write(key)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+	"github.com/peeley/carpal/internal/driver/file"
+	"github.com/peeley/carpal/internal/wkd"
+)
+
+// keyOnlyDriver hides every method of the wrapped driver but GetOpenPGPKey.
+type keyOnlyDriver struct {
+	driver.OpenPGPKeyDriver
+}
+
+func TestWKDHandler(t *testing.T) {
+	conf := config.Configuration{
+		Driver: "file",
+		FileConfiguration: &config.FileConfiguration{
+			Directory:           "../../test/nostr",
+			OpenPGPKeyDirectory: "../../test/openpgpkey",
+		},
+	}
+
+	handler := NewWKDHandler(file.NewFileDriver(conf).(driver.OpenPGPKeyDriver), config.WKDConfiguration{})
+	httpHandler := http.HandlerFunc(handler.Handle)
+	bobHash := wkd.Hash("bob")
+
+	t.Run("serves keys in the direct layout", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/openpgpkey/hu/"+bobHash+"?l=Bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		if contentType := responseRecorder.Header().Get("Content-Type"); contentType != "application/octet-stream" {
+			t.Errorf("expected binary content type, got %v", contentType)
+		}
+
+		if body := responseRecorder.Body.String(); body != "\x99\x01\x0dfake-key" {
+			t.Fatalf("got: %q", body)
+		}
+	})
+
+	t.Run("serves keys in the advanced layout", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://openpgpkey.foobar.com/.well-known/openpgpkey/foobar.com/hu/"+bobHash+"?l=bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("serves keys looked up by hash alone", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/openpgpkey/hu/"+bobHash, nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+
+		if body := responseRecorder.Body.String(); body != "\x99\x01\x0dfake-key" {
+			t.Fatalf("got: %q", body)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, "http://example.com/.well-known/openpgpkey/hu/"+bobHash, nil)
+
+		responseRecorder = httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 for other domains, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("hash-only lookups need driver support", func(t *testing.T) {
+		handler := NewWKDHandler(keyOnlyDriver{file.NewFileDriver(conf).(driver.OpenPGPKeyDriver)}, config.WKDConfiguration{})
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/openpgpkey/hu/"+bobHash, nil)
+
+		responseRecorder := httptest.NewRecorder()
+		handler.Handle(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("serves the policy file", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://openpgpkey.foobar.com/.well-known/openpgpkey/foobar.com/policy", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("mismatched hashes return 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/openpgpkey/hu/"+wkd.Hash("alice")+"?l=bob", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+
+	t.Run("unknown users return 404", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/openpgpkey/hu/"+wkd.Hash("alice")+"?l=alice", nil)
+
+		responseRecorder := httptest.NewRecorder()
+		httpHandler.ServeHTTP(responseRecorder, req)
+
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", responseRecorder.Code)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/peeley/carpal/internal/driver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	DEFAULT_METRICS_PATH = "/metrics"
+	namespace            = "carpal"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total HTTP requests by route and status code.",
+	}, []string{"handler", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"handler"})
+
+	webFingerRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webfinger_requests_total",
+		Help:      "Total WebFinger requests by whether they filtered links by rel.",
+	}, []string{"rel_filter"})
+
+	driverLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "driver_lookups_total",
+		Help:      "Total resource lookups by driver and result, one of found, not_found or error.",
+	}, []string{"driver", "result"})
+
+	driverLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "driver_lookup_duration_seconds",
+		Help:      "Latency of resource lookups by driver.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"driver"})
+
+	aliasIndexEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "file_alias_index_entries",
+		Help:      "Number of aliases in the file driver's alias index.",
+	})
+
+	ldapServerUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ldap_server_up",
+		Help:      "Whether the LDAP server is considered available.",
+	}, []string{"server"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		webFingerRequestsTotal,
+		driverLookupsTotal,
+		driverLookupDuration,
+		aliasIndexEntries,
+		ldapServerUp,
+	)
+}
+
+// Handler returns the handler serving every metric in the Prometheus text
+// format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the count and latency of the requests served by next.
+// Requests are labeled by the pattern of the matched route, so that next should
+// be the ServeMux carpal's handlers are registered on.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "none"
+		}
+
+		requestsTotal.WithLabelValues(route, strconv.Itoa(recorder.status)).Inc()
+		requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveWebFingerRequest records whether a WebFinger request filtered the
+// returned links by rel.
+func ObserveWebFingerRequest(relFilter bool) {
+	webFingerRequestsTotal.WithLabelValues(strconv.FormatBool(relFilter)).Inc()
+}
+
+// ObserveLookup records the latency and result of a driver lookup which
+// started at the given time.
+func ObserveLookup(driverName string, start time.Time, err error) {
+	result := "found"
+	if errors.As(err, &driver.ResourceNotFound{}) {
+		result = "not_found"
+	} else if err != nil {
+		result = "error"
+	}
+
+	driverLookupsTotal.WithLabelValues(driverName, result).Inc()
+	driverLookupDuration.WithLabelValues(driverName).Observe(time.Since(start).Seconds())
+}
+
+// SetAliasIndexEntries records the size of the file driver's alias index.
+func SetAliasIndexEntries(entries int) {
+	aliasIndexEntries.Set(float64(entries))
+}
+
+// SetLDAPServerUp records whether the LDAP server is considered available.
+func SetLDAPServerUp(server string, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+
+	ldapServerUp.WithLabelValues(server).Set(value)
+}
+
+// RegisterDatabase exposes the connection pool statistics of the database.
+func RegisterDatabase(db *sql.DB, name string) {
+	err := registry.Register(collectors.NewDBStatsCollector(db, name))
+	if err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		slog.Error("unable to register database metrics", "err", err)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/driver"
+)
+
+func TestMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/avatar/{user}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := Middleware(mux)
+
+	// the registry is global, so start from zero when run repeatedly
+	requestsTotal.Reset()
+	requestDuration.Reset()
+
+	t.Run("counts requests by route and status code", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/avatar/bob", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		req, _ = http.NewRequest(http.MethodGet, "http://foobar.com/unknown", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		body := scrape(t)
+		for _, want := range []string{
+			`carpal_http_requests_total{code="404",handler="/avatar/{user}"} 1`,
+			`carpal_http_requests_total{code="404",handler="none"} 1`,
+			`carpal_http_request_duration_seconds_count{handler="/avatar/{user}"} 1`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected metrics to contain %s", want)
+			}
+		}
+	})
+}
+
+func TestObserveLookup(t *testing.T) {
+	driverLookupsTotal.Reset()
+	driverLookupDuration.Reset()
+
+	t.Run("counts lookups by driver and result", func(t *testing.T) {
+		start := time.Now()
+		ObserveLookup("file", start, nil)
+		ObserveLookup("file", start, driver.ResourceNotFound{ResourceName: "acct:alice@foobar.com"})
+		ObserveLookup("file", start, errors.New("connection refused"))
+
+		body := scrape(t)
+		for _, want := range []string{
+			`carpal_driver_lookups_total{driver="file",result="found"} 1`,
+			`carpal_driver_lookups_total{driver="file",result="not_found"} 1`,
+			`carpal_driver_lookups_total{driver="file",result="error"} 1`,
+			`carpal_driver_lookup_duration_seconds_count{driver="file"} 3`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("expected metrics to contain %s", want)
+			}
+		}
+	})
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/metrics", nil)
+	responseRecorder := httptest.NewRecorder()
+	Handler().ServeHTTP(responseRecorder, req)
+
+	body, err := io.ReadAll(responseRecorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+// commonLogTime is the timestamp layout of the Common Log Format.
+const commonLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog logs every request served by next to out, in the configured
+// format.
+func AccessLog(conf config.AccessLogConfiguration, resolver ClientIPResolver, out io.Writer, next http.Handler) http.Handler {
+	jsonLogger := slog.New(slog.NewJSONHandler(out, nil))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		entry := accessLogEntry{
+			request:  r,
+			clientIP: resolver.ClientIP(r),
+			start:    start,
+			duration: time.Since(start),
+			status:   recorder.status,
+			bytes:    recorder.bytes,
+		}
+
+		switch conf.Format {
+		case config.AccessLogCommon:
+			fmt.Fprintln(out, entry.common())
+		case config.AccessLogCombined:
+			fmt.Fprintln(out, entry.combined())
+		default:
+			jsonLogger.LogAttrs(context.Background(), slog.LevelInfo, "access", entry.attrs(conf.Fields)...)
+		}
+	})
+}
+
+type accessLogEntry struct {
+	request  *http.Request
+	clientIP string
+	start    time.Time
+	duration time.Duration
+	status   int
+	bytes    int
+}
+
+func (entry accessLogEntry) attrs(fields []string) []slog.Attr {
+	r := entry.request
+	attrs := make([]slog.Attr, 0, len(fields))
+
+	for _, field := range fields {
+		switch field {
+		case "remote_addr":
+			attrs = append(attrs, slog.String(field, entry.clientIP))
+		case "method":
+			attrs = append(attrs, slog.String(field, r.Method))
+		case "host":
+			attrs = append(attrs, slog.String(field, r.Host))
+		case "path":
+			attrs = append(attrs, slog.String(field, r.URL.Path))
+		case "query":
+			attrs = append(attrs, slog.String(field, r.URL.RawQuery))
+		case "protocol":
+			attrs = append(attrs, slog.String(field, r.Proto))
+		case "status":
+			attrs = append(attrs, slog.Int(field, entry.status))
+		case "bytes":
+			attrs = append(attrs, slog.Int(field, entry.bytes))
+		case "duration_ms":
+			attrs = append(attrs, slog.Float64(field, float64(entry.duration.Microseconds())/1000))
+		case "user_agent":
+			attrs = append(attrs, slog.String(field, r.UserAgent()))
+		case "referer":
+			attrs = append(attrs, slog.String(field, r.Referer()))
+		}
+	}
+
+	return attrs
+}
+
+// common formats the entry in the Common Log Format, e.g.
+// `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /x HTTP/1.1" 200 2326`.
+func (entry accessLogEntry) common() string {
+	r := entry.request
+
+	bytes := "-"
+	if entry.bytes != 0 {
+		bytes = strconv.Itoa(entry.bytes)
+	}
+
+	return fmt.Sprintf(
+		"%s - - [%s] %s %d %s",
+		entry.clientIP,
+		entry.start.Format(commonLogTime),
+		strconv.Quote(r.Method+" "+r.URL.RequestURI()+" "+r.Proto),
+		entry.status,
+		bytes,
+	)
+}
+
+// combined formats the entry in the Combined Log Format, which adds the
+// referer and user agent to the Common Log Format.
+func (entry accessLogEntry) combined() string {
+	return fmt.Sprintf(
+		"%s %s %s",
+		entry.common(),
+		strconv.Quote(dashIfEmpty(entry.request.Referer())),
+		strconv.Quote(dashIfEmpty(entry.request.UserAgent())),
+	)
+}
+
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(body []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(body)
+	r.bytes += n
+	return n, err
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
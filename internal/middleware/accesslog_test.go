@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestAccessLog(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/webfinger?resource=acct:bob@foobar.com", nil)
+		req.RemoteAddr = "203.0.113.5:1234"
+		req.Header.Set("User-Agent", "Mastodon/4.2")
+		return req
+	}
+
+	t.Run("logs configured fields as JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		conf := config.AccessLogConfiguration{
+			Format: config.AccessLogJSON,
+			Fields: []string{"remote_addr", "method", "path", "status", "bytes", "user_agent"},
+		}
+
+		AccessLog(conf, NewClientIPResolver(nil), &out, next).ServeHTTP(httptest.NewRecorder(), newRequest())
+
+		var got map[string]any
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		delete(got, "time")
+
+		want := map[string]any{
+			"level":       "INFO",
+			"msg":         "access",
+			"remote_addr": "203.0.113.5",
+			"method":      "GET",
+			"path":        "/.well-known/webfinger",
+			"status":      float64(404),
+			"bytes":       float64(9),
+			"user_agent":  "Mastodon/4.2",
+		}
+		if !cmp.Equal(got, want) {
+			t.Errorf("got:  %+v,\n want: %+v", got, want)
+		}
+	})
+
+	t.Run("logs in the combined log format", func(t *testing.T) {
+		var out bytes.Buffer
+		conf := config.AccessLogConfiguration{Format: config.AccessLogCombined}
+
+		AccessLog(conf, NewClientIPResolver(nil), &out, next).ServeHTTP(httptest.NewRecorder(), newRequest())
+
+		want := regexp.MustCompile(`^203\.0\.113\.5 - - \[[^\]]+\] "GET /\.well-known/webfinger\?resource=acct:bob@foobar\.com HTTP/1\.1" 404 9 "-" "Mastodon/4\.2"\n$`)
+		if !want.Match(out.Bytes()) {
+			t.Errorf("unexpected log line: %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver determines the address of the client making a request,
+// trusting the X-Forwarded-For header only when the request comes from one of
+// the trusted proxies.
+type ClientIPResolver struct {
+	trustedProxies []netip.Prefix
+}
+
+// NewClientIPResolver returns a resolver trusting the given CIDRs, which must
+// already be validated.
+func NewClientIPResolver(trustedProxies []string) ClientIPResolver {
+	return ClientIPResolver{parsePrefixes(trustedProxies)}
+}
+
+// ClientIP returns the address of the client. The X-Forwarded-For header is
+// walked from the right, as each trusted proxy appends the address it received
+// the request from, and the first untrusted address is the client.
+func (resolver ClientIPResolver) ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+
+	if !resolver.isTrusted(remote) {
+		return remote
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+
+	client := remote
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(forwarded[i]); err != nil {
+			break
+		}
+
+		client = forwarded[i]
+		if !resolver.isTrusted(client) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (resolver ClientIPResolver) isTrusted(addr string) bool {
+	return containsAddr(resolver.trustedProxies, addr)
+}
+
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
+
+func containsAddr(prefixes []netip.Prefix, addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
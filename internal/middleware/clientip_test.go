@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1/32"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"untrusted peers are the client", "203.0.113.5:1234", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxies pass on the client", "10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"chained trusted proxies are skipped", "10.0.0.1:1234", "198.51.100.7, 192.168.1.1", "198.51.100.7"},
+		{"spoofed addresses left of the client are ignored", "10.0.0.1:1234", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"trusted proxies without header are the client", "10.0.0.1:1234", "", "10.0.0.1"},
+		{"invalid forwarded addresses stop the walk", "10.0.0.1:1234", "198.51.100.7, garbage", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+
+			if got := resolver.ClientIP(req); got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/peeley/carpal/internal/config"
+)
+
+const DEFAULT_COMPRESSION_MIN_SIZE = 1024
+
+// encoder is implemented by the writers of every supported encoding, so that
+// they can be pooled and reused.
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	config.CompressionGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	config.CompressionBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	config.CompressionZstd: {New: func() any {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}},
+}
+
+// Compress compresses the responses of next with the first configured
+// encoding the client accepts, if their bodies are at least the configured
+// minimum size and of a textual content type.
+func Compress(conf config.CompressionConfiguration, next http.Handler) http.Handler {
+	minSize := conf.MinSize
+	if minSize == 0 {
+		minSize = DEFAULT_COMPRESSION_MIN_SIZE
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), conf.Encodings)
+		if r.Method == http.MethodHead {
+			encoding = ""
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the first of the offered encodings with a nonzero
+// quality in the Accept-Encoding header, or an empty string if there is none.
+func negotiateEncoding(header string, offered []string) string {
+	accepted := map[string]float64{}
+	for _, entry := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(entry, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		accepted[coding] = quality
+	}
+
+	for _, encoding := range offered {
+		quality, ok := accepted[encoding]
+		if !ok {
+			quality, ok = accepted["*"]
+		}
+		if ok && quality > 0 {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// compressible reports whether responses of the content type are worth
+// compressing, which excludes images and other binary formats.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "image/svg+xml":
+		return true
+	}
+
+	return strings.HasPrefix(mediaType, "application/") &&
+		(strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml"))
+}
+
+// compressWriter buffers the start of the response body until it can tell
+// whether the response is large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	status      int
+	wroteHeader bool
+	started     bool
+	buffer      []byte
+	encoder     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	// informational responses are passed on, as they precede the actual one
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+	cw.wroteHeader = true
+
+	if !bodyAllowed(status) {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(body []byte) (int, error) {
+	cw.wroteHeader = true
+
+	if cw.started {
+		if cw.encoder != nil {
+			return cw.encoder.Write(body)
+		}
+		return cw.ResponseWriter.Write(body)
+	}
+
+	cw.buffer = append(cw.buffer, body...)
+	if len(cw.buffer) >= cw.minSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(body), nil
+}
+
+// Flush sends the buffered body, compressed if possible, to the client.
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(len(cw.buffer) >= cw.minSize)
+	}
+
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// start writes the response headers and the buffered body, compressing the
+// body from here on if requested and the response allows it.
+func (cw *compressWriter) start(compress bool) error {
+	cw.started = true
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && bodyAllowed(cw.status) && len(cw.buffer) != 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buffer))
+	}
+
+	// not modified responses carry the Vary header of the response they stand
+	// in for, whose content type is unknown here
+	eligible := compressible(header.Get("Content-Type")) && header.Get("Content-Encoding") == ""
+	if eligible || cw.status == http.StatusNotModified {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if !eligible {
+		compress = false
+	}
+
+	// not modified responses carry the ETag of the compressed response they
+	// stand in for as well
+	if cw.status == http.StatusNotModified && cw.encoding != "" {
+		weakenETag(header)
+	}
+
+	if compress && cw.encoding != "" && bodyAllowed(cw.status) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		weakenETag(header)
+
+		cw.encoder = encoderPools[cw.encoding].Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buffer) == 0 {
+		return nil
+	}
+
+	buffer := cw.buffer
+	cw.buffer = nil
+
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffer)
+	} else {
+		_, err = cw.ResponseWriter.Write(buffer)
+	}
+
+	return err
+}
+
+// close sends any buffered body too small to be compressed and finishes the
+// compressed stream.
+func (cw *compressWriter) close() {
+	if !cw.started {
+		if !cw.wroteHeader {
+			return
+		}
+		cw.start(false)
+	}
+
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		encoderPools[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// weakenETag marks the ETag as weak, as the compressed body is a different
+// representation than the one the handler's ETag describes.
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestCompress(t *testing.T) {
+	body := `{"subject":"acct:bob@foobar.com","links":[` + strings.Repeat(`{"rel":"self"},`, 100) + `{"rel":"self"}]}`
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "application/jrd+json")
+			w.Write([]byte(`{}`))
+		case "/avatar":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(body))
+		case "/unmodified":
+			w.Header().Set("ETag", `"abc"`)
+			w.WriteHeader(http.StatusNotModified)
+		case "/conditional":
+			w.Header().Set("Content-Type", "application/jrd+json")
+			w.Header().Set("ETag", `"abc"`)
+			if match := r.Header.Get("If-None-Match"); match == `"abc"` || match == `W/"abc"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(body))
+		default:
+			w.Header().Set("Content-Type", "application/jrd+json")
+			w.Header().Set("ETag", `"abc"`)
+			w.Write([]byte(body))
+		}
+	})
+
+	handler := Compress(config.CompressionConfiguration{
+		Encodings: []string{config.CompressionBrotli, config.CompressionZstd, config.CompressionGzip},
+	}, next)
+
+	serveConditional := func(path string, acceptEncoding string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, req)
+
+		return responseRecorder
+	}
+
+	serve := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		return serveConditional(path, acceptEncoding, "")
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for encoding, decode := range decoders {
+		t.Run("compresses with "+encoding, func(t *testing.T) {
+			responseRecorder := serve("/", encoding)
+
+			if got := responseRecorder.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("got Content-Encoding %q, want %q", got, encoding)
+			}
+
+			reader, err := decode(responseRecorder.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(decoded) != body {
+				t.Errorf("got body %q", decoded)
+			}
+
+			if got := responseRecorder.Header().Get("ETag"); got != `W/"abc"` {
+				t.Errorf("expected weakened ETag, got %q", got)
+			}
+		})
+	}
+
+	t.Run("prefers the configured order", func(t *testing.T) {
+		if got := serve("/", "gzip, zstd, br").Header().Get("Content-Encoding"); got != "br" {
+			t.Errorf("got %q, want br", got)
+		}
+
+		if got := serve("/", "gzip, zstd, br;q=0").Header().Get("Content-Encoding"); got != "zstd" {
+			t.Errorf("got %q, want zstd", got)
+		}
+
+		if got := serve("/", "*;q=0.5, br;q=0").Header().Get("Content-Encoding"); got != "zstd" {
+			t.Errorf("got %q, want zstd", got)
+		}
+	})
+
+	t.Run("does not compress without an accepted encoding", func(t *testing.T) {
+		for _, acceptEncoding := range []string{"", "identity", "deflate"} {
+			responseRecorder := serve("/", acceptEncoding)
+
+			if got := responseRecorder.Header().Get("Content-Encoding"); got != "" {
+				t.Errorf("got Content-Encoding %q for %q", got, acceptEncoding)
+			}
+			if responseRecorder.Body.String() != body {
+				t.Errorf("expected uncompressed body for %q", acceptEncoding)
+			}
+			if got := responseRecorder.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("got Vary %q for %q", got, acceptEncoding)
+			}
+			if got := responseRecorder.Header().Get("ETag"); got != `"abc"` {
+				t.Errorf("expected strong ETag, got %q", got)
+			}
+		}
+	})
+
+	t.Run("does not compress small responses", func(t *testing.T) {
+		responseRecorder := serve("/small", "gzip")
+
+		if got := responseRecorder.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("got Content-Encoding %q", got)
+		}
+		if responseRecorder.Body.String() != `{}` {
+			t.Errorf("got body %q", responseRecorder.Body.String())
+		}
+	})
+
+	t.Run("does not compress binary responses", func(t *testing.T) {
+		responseRecorder := serve("/avatar", "gzip")
+
+		if got := responseRecorder.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("got Content-Encoding %q", got)
+		}
+		if got := responseRecorder.Header().Get("Vary"); got != "" {
+			t.Errorf("got Vary %q", got)
+		}
+		if !bytes.Equal(responseRecorder.Body.Bytes(), []byte(body)) {
+			t.Error("expected uncompressed body")
+		}
+	})
+
+	t.Run("passes not modified responses through", func(t *testing.T) {
+		responseRecorder := serve("/unmodified", "gzip")
+
+		if responseRecorder.Code != http.StatusNotModified {
+			t.Fatalf("expected 304, got %v", responseRecorder.Code)
+		}
+		if got := responseRecorder.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("got Content-Encoding %q", got)
+		}
+		if got := responseRecorder.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("got Vary %q", got)
+		}
+	})
+	t.Run("not modified responses carry the ETag of the compressed response", func(t *testing.T) {
+		ok := serveConditional("/conditional", "gzip", "")
+		if ok.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v", ok.Code)
+		}
+
+		etag := ok.Header().Get("ETag")
+		notModified := serveConditional("/conditional", "gzip", etag)
+		if notModified.Code != http.StatusNotModified {
+			t.Fatalf("expected 304, got %v", notModified.Code)
+		}
+
+		if got := notModified.Header().Get("ETag"); got != etag {
+			t.Errorf("got ETag %q on 304, want %q as on 200", got, etag)
+		}
+	})
+}
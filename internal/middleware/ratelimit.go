@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+const DEFAULT_RATE_LIMIT_WINDOW = time.Minute
+
+// RateLimit limits the requests of each client to next with a token bucket.
+// Clients also have a separate, usually smaller, bucket of not found responses,
+// so that probing for valid users is throttled without limiting regular
+// lookups as much.
+func RateLimit(conf config.RateLimitConfiguration, resolver ClientIPResolver, next http.Handler) http.Handler {
+	window := conf.Window
+	if window == 0 {
+		window = DEFAULT_RATE_LIMIT_WINDOW
+	}
+
+	requests := newLimiter(conf.Requests, conf.Burst, window)
+
+	var notFound *limiter
+	if conf.NotFoundRequests != 0 {
+		notFound = newLimiter(conf.NotFoundRequests, conf.NotFoundBurst, window)
+	}
+
+	allow := parsePrefixes(conf.Allow)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := resolver.ClientIP(r)
+		if containsAddr(allow, client) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if notFound != nil {
+			if ok, retryAfter := notFound.check(client); !ok {
+				tooManyRequests(w, client, retryAfter)
+				return
+			}
+		}
+
+		if ok, retryAfter := requests.take(client); !ok {
+			tooManyRequests(w, client, retryAfter)
+			return
+		}
+
+		if notFound == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == http.StatusNotFound {
+			notFound.take(client)
+		}
+	})
+}
+
+func tooManyRequests(w http.ResponseWriter, client string, retryAfter time.Duration) {
+	slog.Warn("rate limiting client", "client", client, "retry_after", retryAfter)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte("too many requests"))
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// limiter holds a token bucket per client, refilled at a rate of `requests`
+// tokens per window, up to `burst` tokens.
+type limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newLimiter(requests int, burst int, window time.Duration) *limiter {
+	if burst == 0 {
+		burst = requests
+	}
+
+	return &limiter{
+		rate:    float64(requests) / window.Seconds(),
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// check returns whether the client has a token left, without taking it, and
+// otherwise how long until it has.
+func (l *limiter) check(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(client)
+	if bucket.tokens >= 1 {
+		return true, 0
+	}
+
+	return false, l.wait(bucket)
+}
+
+// take takes a token from the client's bucket if there is one, and otherwise
+// returns how long until there is.
+func (l *limiter) take(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket := l.refill(client)
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	return false, l.wait(bucket)
+}
+
+func (l *limiter) refill(client string) *tokenBucket {
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = math.Min(l.burst, bucket.tokens+elapsed*l.rate)
+	bucket.updated = now
+
+	return bucket
+}
+
+func (l *limiter) wait(bucket *tokenBucket) time.Duration {
+	return time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets clients whose buckets have refilled completely, as they are no
+// different from new clients, so that memory use doesn't grow unbounded.
+func (l *limiter) sweep(now time.Time) {
+	fullAfter := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < fullAfter {
+		return
+	}
+
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= fullAfter {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
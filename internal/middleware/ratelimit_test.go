@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestRateLimit(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") == "acct:alice@foobar.com" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	serve := func(handler http.Handler, remoteAddr string, resource string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/webfinger?resource="+resource, nil)
+		req.RemoteAddr = remoteAddr
+
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, req)
+
+		return responseRecorder
+	}
+
+	t.Run("limits requests per client", func(t *testing.T) {
+		handler := RateLimit(config.RateLimitConfiguration{Requests: 2}, NewClientIPResolver(nil), next)
+
+		for range 2 {
+			if code := serve(handler, "203.0.113.5:1234", "acct:bob@foobar.com").Code; code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %v", code)
+			}
+		}
+
+		responseRecorder := serve(handler, "203.0.113.5:1234", "acct:bob@foobar.com")
+		if responseRecorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %v", responseRecorder.Code)
+		}
+
+		if retryAfter := responseRecorder.Header().Get("Retry-After"); retryAfter != "30" {
+			t.Errorf("got Retry-After %v, want 30", retryAfter)
+		}
+
+		if code := serve(handler, "198.51.100.7:1234", "acct:bob@foobar.com").Code; code != http.StatusOK {
+			t.Errorf("expected other clients to be allowed, got %v", code)
+		}
+	})
+
+	t.Run("limits not found responses separately", func(t *testing.T) {
+		handler := RateLimit(config.RateLimitConfiguration{Requests: 100, NotFoundRequests: 1}, NewClientIPResolver(nil), next)
+
+		if code := serve(handler, "203.0.113.5:1234", "acct:alice@foobar.com").Code; code != http.StatusNotFound {
+			t.Fatalf("expected 404, got %v", code)
+		}
+
+		if code := serve(handler, "203.0.113.5:1234", "acct:bob@foobar.com").Code; code != http.StatusTooManyRequests {
+			t.Fatalf("expected 429, got %v", code)
+		}
+	})
+
+	t.Run("does not limit allowed clients", func(t *testing.T) {
+		conf := config.RateLimitConfiguration{Requests: 1, Allow: []string{"203.0.113.0/24"}}
+		handler := RateLimit(conf, NewClientIPResolver(nil), next)
+
+		for range 3 {
+			if code := serve(handler, "203.0.113.5:1234", "acct:bob@foobar.com").Code; code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %v", code)
+			}
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("refills tokens over time", func(t *testing.T) {
+		now := time.Now()
+		l := newLimiter(60, 1, time.Minute)
+		l.now = func() time.Time { return now }
+
+		if ok, _ := l.take("client"); !ok {
+			t.Fatal("expected first token to be taken")
+		}
+
+		ok, retryAfter := l.take("client")
+		if ok {
+			t.Fatal("expected bucket to be empty")
+		}
+		if retryAfter != time.Second {
+			t.Errorf("got retry after %v, want 1s", retryAfter)
+		}
+
+		now = now.Add(time.Second)
+		if ok, _ := l.take("client"); !ok {
+			t.Error("expected bucket to be refilled")
+		}
+	})
+
+	t.Run("forgets clients with full buckets", func(t *testing.T) {
+		now := time.Now()
+		l := newLimiter(60, 1, time.Minute)
+		l.now = func() time.Time { return now }
+
+		l.take("client")
+		now = now.Add(time.Minute)
+		l.take("other")
+
+		if _, ok := l.buckets["client"]; ok {
+			t.Error("expected refilled client to be forgotten")
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package resource
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Host returns the host a resource belongs to, e.g. `foobar.com` for both
+// `acct:bob@foobar.com` and `https://foobar.com/~bob`. An empty string is
+// returned if the resource has no discernible host.
+func Host(name string) string {
+	parsed, err := url.Parse(name)
+	if err != nil {
+		return ""
+	}
+
+	if parsed.Opaque == "" {
+		return strings.ToLower(parsed.Host)
+	}
+
+	at := strings.LastIndex(parsed.Opaque, "@")
+	if at == -1 {
+		return ""
+	}
+
+	return strings.ToLower(parsed.Opaque[at+1:])
+}
+
+// WithHost returns the resource with its host replaced, e.g.
+// `acct:bob@example.com` for `acct:bob@foobar.com` and `example.com`.
+func WithHost(name string, host string) string {
+	parsed, err := url.Parse(name)
+	if err != nil {
+		return name
+	}
+
+	if parsed.Opaque == "" {
+		if parsed.Host == "" {
+			return name
+		}
+		parsed.Host = host
+		return parsed.String()
+	}
+
+	at := strings.LastIndex(name, "@")
+	if at == -1 {
+		return name
+	}
+
+	return name[:at+1] + host
+}
@@ -0,0 +1,39 @@
+package resource
+
+import "testing"
+
+func TestHost(t *testing.T) {
+	cases := map[string]string{
+		"acct:bob@foobar.com":      "foobar.com",
+		"mailto:Bob@FooBar.com":    "foobar.com",
+		"https://foobar.com/~bob":  "foobar.com",
+		"https://foobar.com:8443/": "foobar.com:8443",
+		"acct:bob":                 "",
+		"missingno":                "",
+	}
+
+	for name, want := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := Host(name); got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	cases := map[string]string{
+		"acct:bob@foobar.com":     "acct:bob@example.com",
+		"mailto:bob@foobar.com":   "mailto:bob@example.com",
+		"https://foobar.com/~bob": "https://example.com/~bob",
+		"missingno":               "missingno",
+	}
+
+	for name, want := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := WithHost(name, "example.com"); got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package resource
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type Properties map[string]any
@@ -11,6 +12,7 @@ type Link struct {
 	Rel        string     `json:"rel"`
 	Type       *string    `json:"type,omitempty"`
 	Href       *string    `json:"href,omitempty"`
+	Template   *string    `json:"template,omitempty"`
 	Titles     []string   `json:"titles,omitempty"`
 	Properties Properties `json:"properties,omitempty"`
 }
@@ -20,6 +22,9 @@ type Resource struct {
 	Aliases    []string   `json:"aliases,omitempty"`
 	Properties Properties `json:"properties,omitempty"`
 	Links      []Link     `json:"links,omitempty"`
+
+	// ModTime is when the resource was last modified, if the driver knows.
+	ModTime time.Time `json:"-" yaml:"-"`
 }
 
 func MarshalResource(resource Resource) ([]byte, error) {
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+// SD_LISTEN_FDS_START is the first file descriptor passed by systemd socket
+// activation.
+const SD_LISTEN_FDS_START = 3
+
+// Listen listens on the address, which is either a Unix socket path like
+// `unix:/run/carpal.sock` or a TCP address like `tcp://[::1]:8008` or `:8008`.
+// Unix sockets are given the configured socket mode.
+func Listen(conf config.ServerConfiguration, address string) (net.Listener, error) {
+	network, addr := parseListenAddress(address)
+	if network == "tcp" {
+		return net.Listen(network, addr)
+	}
+
+	if err := removeStaleSocket(addr); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.SocketMode != "" {
+		mode, _ := strconv.ParseUint(conf.SocketMode, 8, 32)
+		if err := os.Chmod(addr, os.FileMode(mode)); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("unable to set mode of socket %s: %w", addr, err)
+		}
+	}
+
+	return listener, nil
+}
+
+// ListenerPort returns the port of the first TCP listener, if there is one.
+func ListenerPort(listeners []net.Listener) (string, bool) {
+	for _, listener := range listeners {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+			return strconv.Itoa(addr.Port), true
+		}
+	}
+
+	return "", false
+}
+
+func parseListenAddress(address string) (string, string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", strings.TrimPrefix(path, "//")
+	}
+
+	return "tcp", strings.TrimPrefix(address, "tcp://")
+}
+
+// removeStaleSocket removes a socket left behind by a previous run which did
+// not shut down cleanly, unless another process is still listening on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unable to listen on %s, file exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("unable to listen on %s, socket is in use", path)
+	}
+
+	return os.Remove(path)
+}
+
+// SystemdListeners returns the listeners passed by systemd socket activation,
+// or none if carpal wasn't socket activated.
+func SystemdListeners() ([]net.Listener, error) {
+	listeners, err := systemdListeners(os.Getenv, SD_LISTEN_FDS_START)
+
+	// like sd_listen_fds(3), stop child processes from inheriting the sockets
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	return listeners, err
+}
+
+func systemdListeners(getenv func(string) string, firstFD int) ([]net.Listener, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS `%s`", getenv("LISTEN_FDS"))
+	}
+
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := []net.Listener{}
+	for i := range count {
+		name := fmt.Sprintf("LISTEN_FD_%d", firstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		// FileListener duplicates the descriptor, so the inherited one is closed
+		file := os.NewFile(uintptr(firstFD+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("unable to use socket %s passed by systemd: %w", name, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
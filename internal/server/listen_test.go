@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestListen(t *testing.T) {
+	t.Run("listens on unix sockets with the configured mode", func(t *testing.T) {
+		socketPath := path.Join(t.TempDir(), "carpal.sock")
+
+		listener, err := Listen(config.ServerConfiguration{SocketMode: "0660"}, "unix:"+socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		info, err := os.Stat(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mode := info.Mode().Perm(); mode != 0660 {
+			t.Errorf("got mode %o, want 660", mode)
+		}
+	})
+
+	t.Run("replaces stale sockets", func(t *testing.T) {
+		socketPath := path.Join(t.TempDir(), "carpal.sock")
+
+		stale, err := net.Listen("unix", socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		listener, err := Listen(config.ServerConfiguration{}, "unix://"+socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listener.Close()
+	})
+
+	t.Run("refuses sockets in use", func(t *testing.T) {
+		socketPath := path.Join(t.TempDir(), "carpal.sock")
+
+		listener, err := Listen(config.ServerConfiguration{}, "unix:"+socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		if _, err := Listen(config.ServerConfiguration{}, "unix:"+socketPath); err == nil {
+			t.Error("expected error listening on socket in use")
+		}
+	})
+
+	t.Run("listens on tcp addresses", func(t *testing.T) {
+		for _, address := range []string{"tcp://127.0.0.1:0", "127.0.0.1:0"} {
+			listener, err := Listen(config.ServerConfiguration{}, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if network := listener.Addr().Network(); network != "tcp" {
+				t.Errorf("got network %v for %v", network, address)
+			}
+			listener.Close()
+		}
+	})
+}
+
+func TestListenerPort(t *testing.T) {
+	t.Run("returns the port of the first tcp listener", func(t *testing.T) {
+		unixListener, err := Listen(config.ServerConfiguration{}, "unix:"+path.Join(t.TempDir(), "carpal.sock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unixListener.Close()
+
+		tcpListener, err := Listen(config.ServerConfiguration{}, "tcp://127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcpListener.Close()
+
+		port, ok := ListenerPort([]net.Listener{unixListener, tcpListener})
+		if !ok {
+			t.Fatal("expected a port")
+		}
+
+		if want := strconv.Itoa(tcpListener.Addr().(*net.TCPAddr).Port); port != want {
+			t.Errorf("got port %v, want %v", port, want)
+		}
+	})
+
+	t.Run("unix sockets have no port", func(t *testing.T) {
+		unixListener, err := Listen(config.ServerConfiguration{}, "unix:"+path.Join(t.TempDir(), "carpal.sock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unixListener.Close()
+
+		if _, ok := ListenerPort([]net.Listener{unixListener}); ok {
+			t.Error("expected no port")
+		}
+	})
+}
+
+func TestSystemdListeners(t *testing.T) {
+	t.Run("ignores listeners meant for other processes", func(t *testing.T) {
+		env := map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}
+
+		listeners, err := systemdListeners(func(key string) string { return env[key] }, SD_LISTEN_FDS_START)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(listeners) != 0 {
+			t.Errorf("got %v listeners, want none", len(listeners))
+		}
+	})
+
+	t.Run("inherits passed listeners", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tcpListener.Close()
+
+		file, err := tcpListener.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		// systemdListeners closes the descriptors it inherits
+		fd, err := syscall.Dup(int(file.Fd()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		env := map[string]string{
+			"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+			"LISTEN_FDS":     "1",
+			"LISTEN_FDNAMES": "carpal.socket",
+		}
+
+		listeners, err := systemdListeners(func(key string) string { return env[key] }, fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(listeners) != 1 {
+			t.Fatalf("got %v listeners, want 1", len(listeners))
+		}
+		defer listeners[0].Close()
+
+		if got, want := listeners[0].Addr().String(), tcpListener.Addr().String(); got != want {
+			t.Errorf("got address %v, want %v", got, want)
+		}
+	})
+}
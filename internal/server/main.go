@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+const (
+	DEFAULT_READ_TIMEOUT        = 30 * time.Second
+	DEFAULT_READ_HEADER_TIMEOUT = 10 * time.Second
+	DEFAULT_WRITE_TIMEOUT       = 30 * time.Second
+	DEFAULT_IDLE_TIMEOUT        = 2 * time.Minute
+	DEFAULT_MAX_HEADER_BYTES    = http.DefaultMaxHeaderBytes
+	DEFAULT_SHUTDOWN_TIMEOUT    = 30 * time.Second
+)
+
+// Server is an HTTP server run by Run. If Listener is nil, the server listens
+// on the address of the HTTP server.
+type Server struct {
+	HTTP     *http.Server
+	Listener net.Listener
+	TLS      bool
+}
+
+// NewHTTPServer returns an HTTP server with the configured timeouts and limits,
+// falling back to defaults which protect against slow clients.
+func NewHTTPServer(conf config.ServerConfiguration, addr string, handler http.Handler) *http.Server {
+	withDefault := func(value time.Duration, fallback time.Duration) time.Duration {
+		if value == 0 {
+			return fallback
+		}
+		return value
+	}
+
+	maxHeaderBytes := conf.MaxHeaderBytes
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = DEFAULT_MAX_HEADER_BYTES
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       withDefault(conf.ReadTimeout, DEFAULT_READ_TIMEOUT),
+		ReadHeaderTimeout: withDefault(conf.ReadHeaderTimeout, DEFAULT_READ_HEADER_TIMEOUT),
+		WriteTimeout:      withDefault(conf.WriteTimeout, DEFAULT_WRITE_TIMEOUT),
+		IdleTimeout:       withDefault(conf.IdleTimeout, DEFAULT_IDLE_TIMEOUT),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
+
+// Run serves every server until one of them fails or the context is done, and
+// then shuts all of them down, waiting up to shutdownTimeout for in-flight
+// requests to finish.
+func Run(ctx context.Context, shutdownTimeout time.Duration, servers ...Server) error {
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+
+	serveErrs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			serveErrs <- srv.serve()
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down carpal server...")
+	case err = <-serveErrs:
+		slog.Error("carpal server failed, shutting down", "err", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if shutdownErr := srv.HTTP.Shutdown(shutdownCtx); shutdownErr != nil {
+				mu.Lock()
+				err = errors.Join(err, shutdownErr)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return err
+}
+
+func (srv Server) serve() error {
+	var err error
+
+	switch {
+	case srv.Listener != nil && srv.TLS:
+		err = srv.HTTP.ServeTLS(srv.Listener, "", "")
+	case srv.Listener != nil:
+		err = srv.HTTP.Serve(srv.Listener)
+	case srv.TLS:
+		err = srv.HTTP.ListenAndServeTLS("", "")
+	default:
+		err = srv.HTTP.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	t.Run("defaults unset timeouts and limits", func(t *testing.T) {
+		srv := NewHTTPServer(config.ServerConfiguration{WriteTimeout: 5 * time.Second}, ":8008", nil)
+
+		if srv.WriteTimeout != 5*time.Second {
+			t.Errorf("got write timeout %v, want 5s", srv.WriteTimeout)
+		}
+
+		if srv.ReadHeaderTimeout != DEFAULT_READ_HEADER_TIMEOUT {
+			t.Errorf("got read header timeout %v, want %v", srv.ReadHeaderTimeout, DEFAULT_READ_HEADER_TIMEOUT)
+		}
+
+		if srv.MaxHeaderBytes != DEFAULT_MAX_HEADER_BYTES {
+			t.Errorf("got max header bytes %v, want %v", srv.MaxHeaderBytes, DEFAULT_MAX_HEADER_BYTES)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("drains in-flight requests on shutdown", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		started := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		runErr := make(chan error)
+		go func() {
+			srv := Server{HTTP: NewHTTPServer(config.ServerConfiguration{}, "", handler), Listener: listener}
+			runErr <- Run(ctx, time.Second, srv)
+		}()
+
+		responses := make(chan string)
+		go func() {
+			response, err := http.Get("http://" + listener.Addr().String())
+			if err != nil {
+				responses <- err.Error()
+				return
+			}
+			defer response.Body.Close()
+
+			body, _ := io.ReadAll(response.Body)
+			responses <- string(body)
+		}()
+
+		<-started
+		cancel()
+
+		if body := <-responses; body != "done" {
+			t.Errorf("got: %v, want: done", body)
+		}
+
+		if err := <-runErr; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("stops when a server fails", func(t *testing.T) {
+		srv := Server{HTTP: NewHTTPServer(config.ServerConfiguration{}, "invalid address", nil)}
+
+		if err := Run(context.Background(), time.Second, srv); err == nil {
+			t.Error("expected error from failing server")
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+const DEFAULT_CERTIFICATE_RELOAD_INTERVAL = time.Minute
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig loads the configured certificates, and keeps reloading them
+// whenever the files change on disk.
+func NewTLSConfig(conf config.TLSConfiguration) (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	if conf.MinVersion != "" {
+		var ok bool
+		minVersion, ok = tlsVersions[conf.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS version `%s`", conf.MinVersion)
+		}
+	}
+
+	store, err := newCertificateStore(conf.Certificates)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := conf.ReloadInterval
+	if interval == 0 {
+		interval = DEFAULT_CERTIFICATE_RELOAD_INTERVAL
+	}
+	go store.watch(interval)
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: store.getCertificate,
+	}, nil
+}
+
+// NewRedirectHandler returns a handler redirecting every request to the same
+// URL over HTTPS on the given port.
+func NewRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+type certificatePair struct {
+	CertFile    string
+	KeyFile     string
+	modTime     time.Time
+	certificate *tls.Certificate
+}
+
+// certificateStore holds the loaded certificates, in the order they were
+// configured.
+type certificateStore struct {
+	mu    sync.RWMutex
+	pairs []*certificatePair
+}
+
+func newCertificateStore(certificates []config.TLSCertificate) (*certificateStore, error) {
+	store := &certificateStore{}
+
+	for _, certificate := range certificates {
+		pair := &certificatePair{CertFile: certificate.CertFile, KeyFile: certificate.KeyFile}
+		if err := pair.load(); err != nil {
+			return nil, err
+		}
+		store.pairs = append(store.pairs, pair)
+	}
+
+	return store, nil
+}
+
+func (s *certificateStore) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.reload()
+	}
+}
+
+// reload reloads every pair whose files changed since they were last loaded.
+// If a pair fails to load, e.g. as only one of its files has been replaced so
+// far, the previous certificate is kept and loading is retried next time.
+func (s *certificateStore) reload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pair := range s.pairs {
+		modTime, err := pair.latestModTime()
+		if err != nil {
+			slog.Error("unable to check certificate files", "cert_file", pair.CertFile, "err", err)
+			continue
+		}
+
+		if modTime.Equal(pair.modTime) {
+			continue
+		}
+
+		if err := pair.load(); err != nil {
+			slog.Error("unable to reload certificate, keeping previous certificate", "cert_file", pair.CertFile, "err", err)
+			continue
+		}
+
+		slog.Info("reloaded certificate", "cert_file", pair.CertFile)
+	}
+}
+
+// getCertificate returns the first certificate valid for the requested server
+// name, or the first certificate if none of them are.
+func (s *certificateStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, pair := range s.pairs {
+		if hello.SupportsCertificate(pair.certificate) == nil {
+			return pair.certificate, nil
+		}
+	}
+
+	return s.pairs[0].certificate, nil
+}
+
+func (pair *certificatePair) load() error {
+	modTime, err := pair.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate %s: %w", pair.CertFile, err)
+	}
+
+	pair.certificate = &certificate
+	pair.modTime = modTime
+
+	return nil
+}
+
+func (pair *certificatePair) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range []string{pair.CertFile, pair.KeyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to read certificate file: %w", err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/peeley/carpal/internal/config"
+)
+
+func TestCertificateStore(t *testing.T) {
+	directory := t.TempDir()
+	foobar := writeCertificate(t, directory, "foobar.com")
+	example := writeCertificate(t, directory, "example.com")
+
+	store, err := newCertificateStore([]config.TLSCertificate{foobar, example})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("selects certificates by server name", func(t *testing.T) {
+		for _, serverName := range []string{"foobar.com", "example.com"} {
+			certificate, err := store.getCertificate(clientHello(serverName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := certificate.Leaf.Subject.CommonName; got != serverName {
+				t.Errorf("got: %v, want: %v", got, serverName)
+			}
+		}
+	})
+
+	t.Run("falls back to the first certificate", func(t *testing.T) {
+		certificate, err := store.getCertificate(clientHello("unknown.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := certificate.Leaf.Subject.CommonName; got != "foobar.com" {
+			t.Errorf("got: %v, want: foobar.com", got)
+		}
+	})
+
+	t.Run("reloads certificates changed on disk", func(t *testing.T) {
+		previous, _ := store.getCertificate(clientHello("example.com"))
+
+		writeCertificate(t, directory, "example.com")
+		future := time.Now().Add(time.Hour)
+		os.Chtimes(example.CertFile, future, future)
+
+		store.reload()
+
+		current, _ := store.getCertificate(clientHello("example.com"))
+		if current == previous {
+			t.Errorf("expected certificate to be reloaded")
+		}
+	})
+
+	t.Run("keeps certificates which fail to reload", func(t *testing.T) {
+		previous, _ := store.getCertificate(clientHello("foobar.com"))
+
+		os.WriteFile(foobar.KeyFile, []byte("not a key"), 0600)
+
+		store.reload()
+
+		current, _ := store.getCertificate(clientHello("foobar.com"))
+		if current != previous {
+			t.Errorf("expected previous certificate to be kept")
+		}
+	})
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"443", "https://foobar.com/.well-known/webfinger?resource=acct:bob@foobar.com"},
+		{"8443", "https://foobar.com:8443/.well-known/webfinger?resource=acct:bob@foobar.com"},
+	}
+
+	for _, test := range tests {
+		t.Run("redirects to port "+test.port, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://foobar.com:8080/.well-known/webfinger?resource=acct:bob@foobar.com", nil)
+
+			responseRecorder := httptest.NewRecorder()
+			NewRedirectHandler(test.port).ServeHTTP(responseRecorder, req)
+
+			if responseRecorder.Code != http.StatusMovedPermanently {
+				t.Fatalf("expected 301, got %v", responseRecorder.Code)
+			}
+
+			if got := responseRecorder.Header().Get("Location"); got != test.want {
+				t.Errorf("got: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func clientHello(serverName string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+	}
+}
+
+// writeCertificate writes a new self-signed certificate for the domain.
+func writeCertificate(t *testing.T, directory string, domain string) config.TLSCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate := config.TLSCertificate{
+		CertFile: path.Join(directory, domain+".crt"),
+		KeyFile:  path.Join(directory, domain+".key"),
+	}
+
+	os.WriteFile(certificate.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600)
+	os.WriteFile(certificate.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certificate
+}
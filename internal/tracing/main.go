@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/peeley/carpal/internal/config"
+	"github.com/peeley/carpal/internal/driver"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DEFAULT_SERVICE_NAME = "carpal"
+	tracerName           = "github.com/peeley/carpal"
+)
+
+// Setup installs the global tracer provider exporting spans as configured, and
+// the W3C trace context propagator. The returned function flushes any
+// remaining spans, and must be called before exiting.
+func Setup(ctx context.Context, conf config.TracingConfiguration) (func(context.Context) error, error) {
+	exporter, closeOutput, err := newExporter(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = DEFAULT_SERVICE_NAME
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if conf.SampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*conf.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeOutput())
+	}, nil
+}
+
+func newExporter(ctx context.Context, conf config.TracingConfiguration) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch conf.Exporter {
+	case config.TracingExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, noClose, err
+
+	case config.TracingExporterFile:
+		file, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to open tracing file: %w", err)
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(io.Writer(file)))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file.Close, nil
+
+	default:
+		options := []otlptracehttp.Option{}
+		if conf.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) != 0 {
+			options = append(options, otlptracehttp.WithHeaders(conf.Headers))
+		}
+
+		exporter, err := otlptracehttp.New(ctx, options...)
+		return exporter, noClose, err
+	}
+}
+
+// Middleware starts a span for every request, continuing any trace given in
+// the request's trace context headers. Spans are named after the route the
+// request matched, so that next should be the ServeMux carpal's handlers are
+// registered on, or a middleware passing the request on unchanged.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "carpal", otelhttp.WithSpanNameFormatter(
+		func(operation string, r *http.Request) string {
+			if r.Pattern == "" {
+				return r.Method
+			}
+			return r.Method + " " + r.Pattern
+		},
+	))
+}
+
+// Start starts a span as a child of any span in the context.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if err is an error other than the
+// resource not being found.
+func End(span trace.Span, err error) {
+	if err != nil && !errors.As(err, &driver.ResourceNotFound{}) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/peeley/carpal/internal/driver"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "driver.lookup")
+		End(span, driver.ResourceNotFound{ResourceName: "acct:alice@foobar.com"})
+	})
+
+	t.Run("continues incoming traces and names spans by route", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "http://foobar.com/.well-known/webfinger?resource=acct:alice@foobar.com", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %v", len(spans))
+		}
+
+		lookup, request := spans[0], spans[1]
+
+		if request.Name() != "GET /.well-known/webfinger" {
+			t.Errorf("unexpected request span name %v", request.Name())
+		}
+
+		if got := request.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected incoming trace to be continued, got trace %v", got)
+		}
+
+		if lookup.Parent().SpanID() != request.SpanContext().SpanID() {
+			t.Errorf("expected lookup span to be a child of the request span")
+		}
+
+		if lookup.Status().Code == codes.Error {
+			t.Errorf("expected not found lookups not to be errors")
+		}
+	})
+
+	t.Run("marks spans of failed operations as errors", func(t *testing.T) {
+		_, span := Start(context.Background(), "ldap.connect")
+		End(span, errors.New("connection refused"))
+
+		spans := recorder.Ended()
+		if status := spans[len(spans)-1].Status(); status.Code != codes.Error {
+			t.Errorf("expected error status, got %v", status)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package wkd
+
+import (
+	"crypto/sha1"
+	"strings"
+)
+
+const zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// Hash returns the z-base-32 encoded SHA-1 hash of the lowercased local part
+// of an address, as defined by the WKD draft.
+func Hash(localPart string) string {
+	digest := sha1.Sum([]byte(strings.ToLower(localPart)))
+
+	var encoded strings.Builder
+	var buffer, bits uint
+	for _, b := range digest {
+		buffer = buffer<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			encoded.WriteByte(zBase32Alphabet[(buffer>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		encoded.WriteByte(zBase32Alphabet[(buffer<<(5-bits))&0x1f])
+	}
+
+	return encoded.String()
+}
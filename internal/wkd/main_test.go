@@ -0,0 +1,12 @@
+package wkd
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	// example from the WKD draft
+	got := Hash("Joe.Doe")
+	want := "iy9q119eutrkn8s1mk4r39qejnbu3n5q"
+	if got != want {
+		t.Fatalf("got: %+v,\n want: %+v", got, want)
+	}
+}